@@ -2,42 +2,223 @@ package aeno
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"math/rand/v2"
 
 	"github.com/netisu/aeno"
 	"github.com/netisu/ntsm"
 )
 
 type LoadedObject struct {
-	Object *aeno.Object
-	Emitters []ntsm.ParticleEmitter
-	Name     string
-	GLBData []byte
+	Object      *aeno.Object
+	Emitters    []ntsm.ParticleEmitter
+	Textures    []ntsm.Texture // Embedded particle textures
+	Name        string
+	GLBData     []byte
+	LODName     string  // Mesh name, set by LoadObjectLOD
+	LODDistance float32 // Distance from which this level is used, set by LoadObjectLOD
+}
+
+// LoadOptions controls LoadObjectWithOptions
+type LoadOptions struct {
+	// SkipMesh leaves LoadedObject.Object nil instead of parsing the GLB,
+	// for callers that only want the emitters or raw GLB bytes
+	SkipMesh bool
+
+	// SkipParticles leaves LoadedObject.Emitters nil without decoding the
+	// particle block, for callers that only want the mesh
+	SkipParticles bool
 }
 
 // LoadObject decodes an NTSM stream into an aeno object
 func LoadObject(r io.Reader) (*LoadedObject, error) {
-	hdr, glbData, emitters, err := ntsm.Decode(r)
+	return LoadObjectWithOptions(r, LoadOptions{})
+}
+
+// LoadObjectWithOptions is LoadObject with options
+func LoadObjectWithOptions(r io.Reader, opts LoadOptions) (*LoadedObject, error) {
+	hdr, glbData, emitters, textures, err := ntsm.DecodeWithOptions(r, ntsm.DecodeOptions{SkipParticles: opts.SkipParticles})
 	if err != nil {
 		return nil, err
 	}
 
-	itemName := string(hdr.Name[:])
-	itemName = itemName[:len(itemName)-1]
+	var obj *aeno.Object
+	if !opts.SkipMesh {
+		if obj, err = newObject(glbData); err != nil {
+			return nil, err
+		}
+	}
 
+	return &LoadedObject{
+		Object:   obj,
+		Emitters: emitters,
+		Textures: textures,
+		Name:     hdr.NameString(),
+		GLBData:  glbData,
+	}, nil
+}
+
+// LoadObjectLOD decodes every level of detail in an NTSM stream, in the
+// order stored. Single-GLB files yield one object
+func LoadObjectLOD(r io.Reader) ([]*LoadedObject, error) {
+	var c ntsm.Container
+	if _, err := c.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	meshes := c.Meshes
+	if len(meshes) == 0 {
+		meshes = []ntsm.GLBEntry{{Name: c.Header.NameString(), Data: c.GLB}}
+	}
+
+	objects := make([]*LoadedObject, len(meshes))
+	for i, m := range meshes {
+		obj, err := newObject(m.Data)
+		if err != nil {
+			return nil, err
+		}
+		objects[i] = &LoadedObject{
+			Object:      obj,
+			Emitters:    c.Emitters,
+			Textures:    c.Textures,
+			Name:        c.Header.NameString(),
+			GLBData:     m.Data,
+			LODName:     m.Name,
+			LODDistance: m.LODDistance,
+		}
+	}
+	return objects, nil
+}
+
+// HasParticles reports whether the object has emitters to spawn. It is false
+// for files without a particle block and for objects loaded with
+// SkipParticles
+func (o *LoadedObject) HasParticles() bool {
+	return len(o.Emitters) > 0
+}
+
+// ResolveEmitterTexture returns the embedded texture data e draws with. It
+// returns false for the default spark (-1) and for indices with no texture
+func (o *LoadedObject) ResolveEmitterTexture(e ntsm.ParticleEmitter) ([]byte, bool) {
+	if e.TextureIndex < 0 || int(e.TextureIndex) >= len(o.Textures) {
+		return nil, false
+	}
+	return o.Textures[e.TextureIndex].Data, true
+}
+
+// EmitterFrames returns the embedded texture data of each flipbook frame e
+// draws, in order, and the rate it plays them at in frames per second, 0
+// meaning the frames are spread over a particle's lifetime. An emitter
+// without a flipbook has its one texture as the only frame. It returns no
+// frames, as ResolveEmitterTexture does, for the default spark and for
+// frames with no texture
+func (o *LoadedObject) EmitterFrames(e ntsm.ParticleEmitter) (frames [][]byte, fps float64) {
+	first, n := int(e.TextureIndex), e.Frames()
+	if first < 0 || first+n > len(o.Textures) {
+		return nil, 0
+	}
+	frames = make([][]byte, n)
+	for i := range frames {
+		frames[i] = o.Textures[first+i].Data
+	}
+	return frames, float64(e.FPS)
+}
+
+// EmitterGroups returns the object's emitters grouped by GroupID, so a
+// renderer can spawn each effect's emitters together
+func (o *LoadedObject) EmitterGroups() map[uint16][]ntsm.ParticleEmitter {
+	return ntsm.GroupEmitters(o.Emitters)
+}
+
+// EmitterOrigin returns e's position and emission direction in world space.
+// SpaceLocal emitters are transformed by the object's Matrix, so they follow
+// the model as it moves; the direction is rotated and scaled but not
+// translated, then renormalized if non-zero. SpaceWorld emitters, and all
+// emitters of an object loaded with SkipMesh, are returned as stored
+func (o *LoadedObject) EmitterOrigin(e ntsm.ParticleEmitter) (position, direction aeno.Vector) {
+	position = aeno.V(float64(e.Position[0]), float64(e.Position[1]), float64(e.Position[2]))
+	direction = aeno.V(float64(e.Direction[0]), float64(e.Direction[1]), float64(e.Direction[2]))
+	if e.Space == ntsm.SpaceWorld || o.Object == nil {
+		return position, direction
+	}
+	position = o.Object.Matrix.MulPosition(position)
+	if direction != (aeno.Vector{}) {
+		direction = o.Object.Matrix.MulDirection(direction)
+	}
+	return position, direction
+}
+
+// ParticleAppearance returns the size and color of a particle from e that
+// has lived for the fraction t of its lifetime, eased between the start and
+// end values by e.Easing
+func ParticleAppearance(e ntsm.ParticleEmitter, t float64) (size float64, color aeno.Color) {
+	f := float64(e.Easing.Apply(float32(t)))
+	size = float64(e.StartSize) + (float64(e.EndSize)-float64(e.StartSize))*f
+	start := aeno.Color{R: float64(e.StartColor[0]), G: float64(e.StartColor[1]), B: float64(e.StartColor[2]), A: float64(e.StartColor[3])}
+	end := aeno.Color{R: float64(e.EndColor[0]), G: float64(e.EndColor[1]), B: float64(e.EndColor[2]), A: float64(e.EndColor[3])}
+	return size, start.Lerp(end, f)
+}
+
+// ParticleGravity returns the acceleration on e's particles, preferring
+// e.GravityVec over the Y-only e.Gravity as ntsm.ParticleEmitter.Acceleration
+// does
+func ParticleGravity(e ntsm.ParticleEmitter) aeno.Vector {
+	a := e.Acceleration()
+	return aeno.V(float64(a[0]), float64(a[1]), float64(a[2]))
+}
+
+// ParticleUV maps uv, a texture coordinate across a particle's quad in
+// [0, 1], into the part of the texture e samples, so emitters sharing an
+// atlas each draw their own region (see ntsm.ParticleEmitter.UVRect)
+func ParticleUV(e ntsm.ParticleEmitter, uv aeno.Vector) aeno.Vector {
+	r := e.UVRect()
+	return aeno.V(float64(r[0])+uv.X*float64(r[2]-r[0]), float64(r[1])+uv.Y*float64(r[3]-r[1]), 0)
+}
+
+// ParticleFrame returns which of e's Frames a particle that has lived for
+// age seconds shows, counting from 0: looping at e.FPS, or stepping through
+// them once over e.ParticleLifetime when e.FPS is 0
+func ParticleFrame(e ntsm.ParticleEmitter, age float64) int {
+	n := e.Frames()
+	var f int
+	switch {
+	case e.FPS > 0:
+		f = int(age*float64(e.FPS)) % n
+	case e.ParticleLifetime > 0:
+		f = int(age / float64(e.ParticleLifetime) * float64(n))
+	}
+	return min(max(f, 0), n-1)
+}
+
+// ParticleRand returns the random source for e's velocity and lifetime
+// jitter: seeded by e.Seed, so playback is the same every time, or randomly
+// when e.Seed is 0
+func ParticleRand(e ntsm.ParticleEmitter) *rand.Rand {
+	if e.Seed == 0 {
+		return rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	return rand.New(rand.NewPCG(uint64(e.Seed), 0))
+}
+
+// ErrCompressedGeometry is returned for GLBs using Draco or meshopt geometry
+// compression, which aeno can't decode; loading them would otherwise fail
+// with no triangles found, or yield an empty mesh
+var ErrCompressedGeometry = errors.New("ntsm: GLB uses compressed geometry, which aeno can't decode")
+
+func newObject(glbData []byte) (*aeno.Object, error) {
+	// Unparsable GLBs are left for aeno to report
+	if ext, err := ntsm.CompressedGeometry(glbData); err == nil && ext != "" {
+		return nil, fmt.Errorf("%w: %s", ErrCompressedGeometry, ext)
+	}
 	mesh, err := aeno.LoadGLTFFromReader(bytes.NewReader(glbData))
 	if err != nil {
 		return nil, err
 	}
 
-	return &LoadedObject{
-		Object: &aeno.Object{
-			Mesh:   mesh,
-			Color:  aeno.Transparent,
-			Matrix: aeno.Identity(),
-		},
-		Emitters: emitters,
-		Name:     itemName,
-		GLBData: glbData,
+	return &aeno.Object{
+		Mesh:   mesh,
+		Color:  aeno.Transparent,
+		Matrix: aeno.Identity(),
 	}, nil
 }
@@ -0,0 +1,285 @@
+package aeno
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/netisu/aeno"
+	"github.com/netisu/ntsm"
+)
+
+// testObject returns an object of n triangles stepping along X
+func testObject(n int) *aeno.Object {
+	var triangles []*aeno.Triangle
+	for i := range n {
+		x := float64(i)
+		triangles = append(triangles, aeno.NewTriangleForPoints(aeno.V(x, 0, 0), aeno.V(x+1, 0, 0), aeno.V(x, 1, 0)))
+	}
+	return aeno.NewObject(aeno.NewTriangleMesh(triangles))
+}
+
+// testObjectGLB returns testObject(n) exported as a GLB
+func testObjectGLB(t *testing.T, n int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := EncodeGLB(&buf, testObject(n)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestLoadSkipMesh loads a file whose GLB aeno can't parse: only SkipMesh
+// succeeds, which shows the parse is skipped
+func TestLoadSkipMesh(t *testing.T) {
+	glb := []byte("glTF not really")
+	emitters := []ntsm.ParticleEmitter{{EmissionRate: 10, TextureIndex: -1}}
+	var hdr ntsm.Header
+	var buf bytes.Buffer
+	if err := ntsm.Encode(&buf, &hdr, glb, emitters); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadObject(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Fatal("LoadObject parsed an invalid GLB")
+	}
+
+	obj, err := LoadObjectWithOptions(bytes.NewReader(buf.Bytes()), LoadOptions{SkipMesh: true})
+	if err != nil {
+		t.Fatalf("LoadObjectWithOptions: %v", err)
+	}
+	if obj.Object != nil {
+		t.Error("Object is set with SkipMesh")
+	}
+	if !bytes.Equal(obj.GLBData, glb) {
+		t.Errorf("GLBData = %q, want %q", obj.GLBData, glb)
+	}
+	if len(obj.Emitters) != 1 || obj.Emitters[0].EmissionRate != 10 {
+		t.Errorf("Emitters = %+v, want %+v", obj.Emitters, emitters)
+	}
+}
+
+// TestLoadName checks the name is trimmed at its terminator, for names
+// that are empty, fill the field, or were truncated to fit it
+func TestLoadName(t *testing.T) {
+	for _, tt := range []struct {
+		name, want string
+	}{
+		{"", ""},
+		{"hat", "hat"},
+		{strings.Repeat("a", 127), strings.Repeat("a", 127)},
+		{strings.Repeat("a", 200), strings.Repeat("a", 127)},
+	} {
+		var hdr ntsm.Header
+		hdr.SetName(tt.name)
+		var buf bytes.Buffer
+		if err := ntsm.Encode(&buf, &hdr, []byte("glTF mesh"), nil); err != nil {
+			t.Fatal(err)
+		}
+		obj, err := LoadObjectWithOptions(bytes.NewReader(buf.Bytes()), LoadOptions{SkipMesh: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if obj.Name != tt.want {
+			t.Errorf("Name for a %d-byte name = %d bytes %q, want %d bytes", len(tt.name), len(obj.Name), obj.Name, len(tt.want))
+		}
+	}
+}
+
+// TestLoadSkipParticles corrupts the particle block: only SkipParticles
+// succeeds, which shows the block isn't decoded
+func TestLoadSkipParticles(t *testing.T) {
+	encode := func(emitters []ntsm.ParticleEmitter) []byte {
+		var hdr ntsm.Header
+		var buf bytes.Buffer
+		if err := ntsm.Encode(&buf, &hdr, []byte("glTF mesh"), emitters); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	load := func(data []byte, skip bool) (*LoadedObject, error) {
+		return LoadObjectWithOptions(bytes.NewReader(data), LoadOptions{SkipMesh: true, SkipParticles: skip})
+	}
+
+	none, err := load(encode(nil), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if none.HasParticles() {
+		t.Error("HasParticles is true without a particle block")
+	}
+
+	data := encode([]ntsm.ParticleEmitter{{EmissionRate: 10, TextureIndex: -1}})
+	obj, err := load(data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !obj.HasParticles() {
+		t.Error("HasParticles is false with a particle block")
+	}
+
+	hdr, err := ntsm.DecodeHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[hdr.ParticleOffset+108] = 0xff // Unknown blend mode
+	if _, err := load(data, false); err == nil {
+		t.Fatal("loaded a corrupt particle block")
+	}
+	obj, err = load(data, true)
+	if err != nil {
+		t.Fatalf("SkipParticles: %v", err)
+	}
+	if obj.HasParticles() || obj.Emitters != nil {
+		t.Errorf("Emitters = %+v with SkipParticles", obj.Emitters)
+	}
+}
+
+func TestLoadObjectLOD(t *testing.T) {
+	emitters := []ntsm.ParticleEmitter{{EmissionRate: 10, TextureIndex: -1}}
+	meshes := []ntsm.GLBEntry{
+		{Name: "high", Data: testObjectGLB(t, 3)},
+		{Name: "low", Data: testObjectGLB(t, 1), LODDistance: 20},
+	}
+	var hdr ntsm.Header
+	hdr.SetName("torch")
+	var buf bytes.Buffer
+	if err := ntsm.EncodeMeshes(&buf, &hdr, meshes, emitters); err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := LoadObjectLOD(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("LoadObjectLOD: %v", err)
+	}
+	if len(objects) != len(meshes) {
+		t.Fatalf("loaded %d levels, want %d", len(objects), len(meshes))
+	}
+	for i, o := range objects {
+		m := meshes[i]
+		if o.LODName != m.Name || o.LODDistance != m.LODDistance || o.Name != "torch" || !bytes.Equal(o.GLBData, m.Data) {
+			t.Errorf("level %d = %q at %g of %q, want %q at %g", i, o.LODName, o.LODDistance, o.Name, m.Name, m.LODDistance)
+		}
+		if want := []int{3, 1}[i]; o.Object == nil || len(o.Object.Mesh.Triangles) != want {
+			t.Errorf("level %d mesh doesn't have %d triangles", i, want)
+		}
+		if len(o.Emitters) != 1 || o.Emitters[0].EmissionRate != 10 {
+			t.Errorf("level %d emitters = %+v", i, o.Emitters)
+		}
+	}
+
+	// A single-GLB file is one level named after the item
+	buf.Reset()
+	hdr = ntsm.Header{}
+	hdr.SetName("hat")
+	if err := ntsm.Encode(&buf, &hdr, meshes[1].Data, nil); err != nil {
+		t.Fatal(err)
+	}
+	objects, err = LoadObjectLOD(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("LoadObjectLOD of a single mesh: %v", err)
+	}
+	if len(objects) != 1 || objects[0].LODName != "hat" || objects[0].LODDistance != 0 || len(objects[0].Object.Mesh.Triangles) != 1 {
+		t.Errorf("single mesh loaded as %d levels: %+v", len(objects), objects)
+	}
+}
+
+func TestParticleAppearance(t *testing.T) {
+	e := ntsm.ParticleEmitter{
+		StartSize:  1,
+		EndSize:    3,
+		StartColor: [4]float32{1, 1, 1, 1},
+		EndColor:   [4]float32{0, 0, 0, 0},
+		Easing:     ntsm.EaseIn,
+	}
+	size, color := ParticleAppearance(e, 0.5)
+	if size != 1.5 || color.R != 0.75 || color.A != 0.75 {
+		t.Errorf("eased halfway = %g, %+v, want 1.5 and 0.75", size, color)
+	}
+
+	e.Easing = ntsm.EaseLinear
+	if size, _ := ParticleAppearance(e, 0.5); size != 2 {
+		t.Errorf("linear halfway size = %g, want 2", size)
+	}
+}
+
+func TestParticleUV(t *testing.T) {
+	var e ntsm.ParticleEmitter
+	if uv := ParticleUV(e, aeno.V(0.25, 0.75, 0)); uv != aeno.V(0.25, 0.75, 0) {
+		t.Errorf("full texture UV = %v", uv)
+	}
+	e.AtlasRect = [4]float32{0.5, 0.25, 1, 0.75}
+	if uv := ParticleUV(e, aeno.V(0.5, 1, 0)); uv != aeno.V(0.75, 0.75, 0) {
+		t.Errorf("atlas UV = %v, want (0.75, 0.75)", uv)
+	}
+}
+
+func TestParticleFrames(t *testing.T) {
+	o := &LoadedObject{Textures: []ntsm.Texture{{Data: []byte("still")}, {Data: []byte("a")}, {Data: []byte("b")}, {Data: []byte("c")}}}
+	e := ntsm.ParticleEmitter{TextureIndex: 1, FrameCount: 3, FPS: 10, ParticleLifetime: 2}
+	frames, fps := o.EmitterFrames(e)
+	if len(frames) != 3 || string(frames[0]) != "a" || string(frames[2]) != "c" || fps != 10 {
+		t.Errorf("EmitterFrames = %q, %g", frames, fps)
+	}
+	e.FrameCount = 4
+	if frames, _ := o.EmitterFrames(e); frames != nil {
+		t.Errorf("frames past the table resolved to %q", frames)
+	}
+	if frames, _ := o.EmitterFrames(ntsm.ParticleEmitter{}); len(frames) != 1 || string(frames[0]) != "still" {
+		t.Errorf("still texture resolved to %q", frames)
+	}
+
+	e.FrameCount = 3
+	for _, tt := range []struct {
+		fps       float32
+		age       float64
+		wantFrame int
+	}{
+		{10, 0.05, 0},
+		{10, 0.15, 1},
+		{10, 0.35, 0}, // Looped
+		{0, 0.5, 0},
+		{0, 1.5, 2},
+		{0, 5, 2}, // Past the lifetime
+	} {
+		e.FPS = tt.fps
+		if got := ParticleFrame(e, tt.age); got != tt.wantFrame {
+			t.Errorf("ParticleFrame at %g fps, age %g = %d, want %d", tt.fps, tt.age, got, tt.wantFrame)
+		}
+	}
+}
+
+func TestParticleRand(t *testing.T) {
+	e := ntsm.ParticleEmitter{Seed: 42}
+	a, b := ParticleRand(e), ParticleRand(e)
+	for range 4 {
+		if x, y := a.Float64(), b.Float64(); x != y {
+			t.Fatalf("seeded sources diverged: %g != %g", x, y)
+		}
+	}
+	e.Seed = 0
+	if ParticleRand(e).Uint64() == ParticleRand(e).Uint64() {
+		t.Error("unseeded sources repeated")
+	}
+}
+
+func TestLoadCompressedGeometry(t *testing.T) {
+	glb, err := os.ReadFile("../../tests/glb/draco.glb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hdr ntsm.Header
+	var buf bytes.Buffer
+	if err := ntsm.Encode(&buf, &hdr, glb, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadObject(bytes.NewReader(buf.Bytes())); !errors.Is(err, ErrCompressedGeometry) {
+		t.Errorf("LoadObject = %v, want ErrCompressedGeometry", err)
+	}
+	if _, err := LoadObjectWithOptions(bytes.NewReader(buf.Bytes()), LoadOptions{SkipMesh: true}); err != nil {
+		t.Errorf("LoadObjectWithOptions with SkipMesh: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package aeno
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/netisu/aeno"
+	"github.com/netisu/ntsm"
+	"github.com/qmuntal/gltf"
+	"github.com/qmuntal/gltf/modeler"
+)
+
+// SaveObject exports obj's mesh to GLB with DefaultExportOptions and writes it as an NTSM stream
+func SaveObject(w io.Writer, obj *aeno.Object, name string, emitters []ntsm.ParticleEmitter) error {
+	var glb bytes.Buffer
+	if err := EncodeGLB(&glb, obj); err != nil {
+		return err
+	}
+
+	var hdr ntsm.Header
+	hdr.SetName(name)
+	return ntsm.Encode(w, &hdr, glb.Bytes(), emitters)
+}
+
+// ExportOptions selects what EncodeGLBWithOptions writes besides vertex
+// positions. The zero value produces a pure-geometry GLB: positions only,
+// with no normals, UVs, colors or materials, and no cameras or lights
+type ExportOptions struct {
+	Normals      bool // Vertex normals (NORMAL)
+	TexCoords    bool // Texture coordinates (TEXCOORD_0)
+	VertexColors bool // Per-vertex colors (COLOR_0)
+	Material     bool // A material whose base color is the object's Color
+}
+
+// DefaultExportOptions are used by EncodeGLB and SaveObject
+var DefaultExportOptions = ExportOptions{Normals: true, TexCoords: true}
+
+// EncodeGLB writes obj as a GLB using DefaultExportOptions
+func EncodeGLB(w io.Writer, obj *aeno.Object) error {
+	return EncodeGLBWithOptions(w, obj, DefaultExportOptions)
+}
+
+// EncodeGLBWithOptions writes obj's triangles as a single-primitive GLB,
+// with the object's matrix baked into the vertices. Lines are not exported
+func EncodeGLBWithOptions(w io.Writer, obj *aeno.Object, opts ExportOptions) error {
+	if obj == nil || obj.Mesh == nil || len(obj.Mesh.Triangles) == 0 {
+		return errors.New("ntsm: object has no triangles to export")
+	}
+
+	n := len(obj.Mesh.Triangles) * 3
+	positions := make([][3]float32, 0, n)
+	var (
+		normals   [][3]float32
+		texCoords [][2]float32
+		colors    [][4]float32
+	)
+	for _, t := range obj.Mesh.Triangles {
+		for _, v := range []aeno.Vertex{t.V1, t.V2, t.V3} {
+			p := obj.Matrix.MulPosition(v.Position)
+			positions = append(positions, [3]float32{float32(p.X), float32(p.Y), float32(p.Z)})
+			if opts.Normals {
+				nrm := obj.Matrix.MulDirection(v.Normal)
+				normals = append(normals, [3]float32{float32(nrm.X), float32(nrm.Y), float32(nrm.Z)})
+			}
+			if opts.TexCoords {
+				texCoords = append(texCoords, [2]float32{float32(v.Texture.X), float32(v.Texture.Y)})
+			}
+			if opts.VertexColors {
+				c := v.Color
+				colors = append(colors, [4]float32{float32(c.R), float32(c.G), float32(c.B), float32(c.A)})
+			}
+		}
+	}
+
+	doc := gltf.NewDocument()
+	prim := &gltf.Primitive{
+		Mode:       gltf.PrimitiveTriangles,
+		Attributes: gltf.PrimitiveAttributes{gltf.POSITION: modeler.WritePosition(doc, positions)},
+	}
+	if opts.Normals {
+		prim.Attributes[gltf.NORMAL] = modeler.WriteNormal(doc, normals)
+	}
+	if opts.TexCoords {
+		prim.Attributes[gltf.TEXCOORD_0] = modeler.WriteTextureCoord(doc, texCoords)
+	}
+	if opts.VertexColors {
+		prim.Attributes[gltf.COLOR_0] = modeler.WriteColor(doc, colors)
+	}
+	if opts.Material {
+		c := obj.Color
+		doc.Materials = []*gltf.Material{{
+			PBRMetallicRoughness: &gltf.PBRMetallicRoughness{
+				BaseColorFactor: &[4]float64{c.R, c.G, c.B, c.A},
+			},
+		}}
+		prim.Material = gltf.Index(0)
+	}
+
+	doc.Meshes = []*gltf.Mesh{{Primitives: []*gltf.Primitive{prim}}}
+	doc.Nodes = []*gltf.Node{{Mesh: gltf.Index(0)}}
+	doc.Scenes[0].Nodes = []int{0}
+
+	return gltf.NewEncoder(w).Encode(doc)
+}
@@ -0,0 +1,56 @@
+package aeno
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/netisu/aeno"
+	"github.com/netisu/ntsm"
+)
+
+// TestSaveObjectRoundTrip saves a moved object and loads it back: the
+// triangles come back with the matrix baked in, with the emitters and name
+func TestSaveObjectRoundTrip(t *testing.T) {
+	obj := testObject(2)
+	obj.Matrix = aeno.Translate(aeno.V(0, 0, 5))
+	emitters := []ntsm.ParticleEmitter{
+		{EmissionRate: 10, ParticleLifetime: 1, TextureIndex: -1},
+		{EmissionRate: 2, TextureIndex: -1, BlendMode: ntsm.BlendAlpha, Seed: 7},
+	}
+
+	var buf bytes.Buffer
+	if err := SaveObject(&buf, obj, "lantern", emitters); err != nil {
+		t.Fatalf("SaveObject: %v", err)
+	}
+	loaded, err := LoadObject(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("LoadObject: %v", err)
+	}
+
+	if loaded.Name != "lantern" {
+		t.Errorf("Name = %q, want lantern", loaded.Name)
+	}
+	if !reflect.DeepEqual(loaded.Emitters, emitters) {
+		t.Errorf("Emitters = %+v, want %+v", loaded.Emitters, emitters)
+	}
+	got, want := loaded.Object.Mesh.Triangles, obj.Mesh.Triangles
+	if len(got) != len(want) {
+		t.Fatalf("loaded %d triangles, want %d", len(got), len(want))
+	}
+	for i := range want {
+		for j, v := range []aeno.Vertex{want[i].V1, want[i].V2, want[i].V3} {
+			g := []aeno.Vertex{got[i].V1, got[i].V2, got[i].V3}[j]
+			if p := obj.Matrix.MulPosition(v.Position); g.Position.Sub(p).Length() > 1e-6 {
+				t.Errorf("triangle %d vertex %d at %v, want %v", i, j, g.Position, p)
+			}
+			if g.Normal.Sub(v.Normal).Length() > 1e-6 {
+				t.Errorf("triangle %d vertex %d normal %v, want %v", i, j, g.Normal, v.Normal)
+			}
+		}
+	}
+
+	if err := SaveObject(&buf, aeno.NewObject(aeno.NewTriangleMesh(nil)), "empty", nil); err == nil {
+		t.Error("SaveObject of an object without triangles succeeded")
+	}
+}
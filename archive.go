@@ -0,0 +1,85 @@
+package ntsm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// ArchiveReader reads NTSM files stored back to back in one stream, such as
+// an .ntsmpack written by ArchiveWriter. Each entry is read whole by Next
+// and ends where its last section does, so no index is needed
+type ArchiveReader struct {
+	r   *bufio.Reader
+	n   int // Entries read so far
+	cur *Container
+	glb *bytes.Reader
+}
+
+// NewArchiveReader returns an ArchiveReader reading from r
+func NewArchiveReader(r io.Reader) *ArchiveReader {
+	return &ArchiveReader{r: bufio.NewReader(r)}
+}
+
+// Next advances to the next entry and returns its header. It returns io.EOF
+// once the stream ends cleanly between entries
+func (a *ArchiveReader) Next() (*Header, error) {
+	a.cur, a.glb = nil, nil
+	if _, err := a.r.Peek(1); err == io.EOF {
+		return nil, io.EOF
+	}
+
+	c := &Container{}
+	if _, err := c.ReadFrom(a.r); err != nil {
+		return nil, fmt.Errorf("ntsm: archive entry %d: %w", a.n, err)
+	}
+	a.n++
+	a.cur, a.glb = c, bytes.NewReader(c.GLB)
+	return &c.Header, nil
+}
+
+// Read reads the current entry's GLB, decompressed. It returns io.EOF at the
+// end of the GLB, or before the first call to Next
+func (a *ArchiveReader) Read(p []byte) (int, error) {
+	if a.glb == nil {
+		return 0, io.EOF
+	}
+	return a.glb.Read(p)
+}
+
+// Emitters returns the current entry's particle emitters
+func (a *ArchiveReader) Emitters() []ParticleEmitter {
+	if a.cur == nil {
+		return nil
+	}
+	return a.cur.Emitters
+}
+
+// Container returns the whole current entry, including its textures,
+// meshes, metadata and thumbnail, or nil before the first call to Next
+func (a *ArchiveReader) Container() *Container {
+	return a.cur
+}
+
+// ArchiveWriter writes NTSM files back to back to one stream, to be read
+// with ArchiveReader
+type ArchiveWriter struct {
+	w io.Writer
+	n int
+}
+
+// NewArchiveWriter returns an ArchiveWriter writing to w
+func NewArchiveWriter(w io.Writer) *ArchiveWriter {
+	return &ArchiveWriter{w: w}
+}
+
+// WriteContainer appends c as the next entry, recomputing its header as
+// Container.WriteTo does
+func (a *ArchiveWriter) WriteContainer(c *Container) error {
+	if _, err := c.WriteTo(a.w); err != nil {
+		return fmt.Errorf("ntsm: archive entry %d: %w", a.n, err)
+	}
+	a.n++
+	return nil
+}
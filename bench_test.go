@@ -0,0 +1,199 @@
+package ntsm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"sync"
+	"testing"
+)
+
+// benchFixture returns a reproducible container with a 1MB GLB and 64
+// emitters, and its encoding. The GLB's binary chunk is seeded noise so
+// compression and checksums see realistic input
+var benchFixture = sync.OnceValues(func() (*Container, []byte) {
+	const binSize = 1 << 20
+	rng := rand.New(rand.NewPCG(1, 2))
+	bin := make([]byte, binSize)
+	for i := range bin {
+		// Mostly small values, like quantized vertex data
+		bin[i] = byte(rng.NormFloat64() * 16)
+	}
+
+	json := []byte(`{"asset":{"version":"2.0"},"buffers":[{"byteLength":1048576}]}  `)
+	var glb bytes.Buffer
+	binary.Write(&glb, binary.LittleEndian, []uint32{0x46546C67, 2, uint32(12 + 8 + len(json) + 8 + binSize), uint32(len(json)), glbJSONChunk})
+	glb.Write(json)
+	binary.Write(&glb, binary.LittleEndian, []uint32{binSize, 0x004E4942})
+	glb.Write(bin)
+
+	c := &Container{GLB: glb.Bytes()}
+	putCString(c.Header.Name[:], "bench")
+	for i := range 64 {
+		f := float32(i)
+		c.Emitters = append(c.Emitters, ParticleEmitter{
+			Position:         [3]float32{f, f / 2, -f},
+			Direction:        [3]float32{0, 1, 0},
+			EmissionRate:     10 + f,
+			ParticleLifetime: 2,
+			StartSize:        1,
+			StartColor:       [4]float32{1, 1, 1, 1},
+			TextureIndex:     -1,
+			GroupID:          uint16(i % 4),
+		})
+	}
+
+	var buf bytes.Buffer
+	if _, err := c.WriteTo(&buf); err != nil {
+		panic(err)
+	}
+	return c, buf.Bytes()
+})
+
+func BenchmarkDecode(b *testing.B) {
+	_, data := benchFixture()
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, _, _, err := Decode(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeAt(b *testing.B) {
+	_, data := benchFixture()
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, _, _, err := DecodeAt(bytes.NewReader(data), int64(len(data))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeSkipGLB(b *testing.B) {
+	_, data := benchFixture()
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, _, _, _, err := DecodeWithOptions(bytes.NewReader(data), DecodeOptions{SkipGLB: true}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	c, data := benchFixture()
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := c.WriteTo(io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkEncodeBuffered reads the GLB into memory before encoding it,
+// as ntsm-migrate did for .glb sources before EncodeStream
+func BenchmarkEncodeBuffered(b *testing.B) {
+	c, data := benchFixture()
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	r := bytes.NewReader(c.GLB)
+	for b.Loop() {
+		hdr := c.Header
+		r.Reset(c.GLB)
+		glb, err := io.ReadAll(r)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := Encode(io.Discard, &hdr, glb, c.Emitters); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkEncodeStream encodes the same GLB as BenchmarkEncodeBuffered,
+// copied from the reader instead
+func BenchmarkEncodeStream(b *testing.B) {
+	c, data := benchFixture()
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	r := bytes.NewReader(c.GLB)
+	for b.Loop() {
+		hdr := c.Header
+		r.Reset(c.GLB)
+		if err := EncodeStream(&discardSeeker{}, &hdr, r, c.Emitters); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// discardSeeker is an io.WriteSeeker that drops what it's given, so
+// EncodeStream can be measured without a file
+type discardSeeker struct {
+	pos, size int64
+}
+
+func (d *discardSeeker) Write(p []byte) (int, error) {
+	d.pos += int64(len(p))
+	d.size = max(d.size, d.pos)
+	return len(p), nil
+}
+
+func (d *discardSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += d.pos
+	case io.SeekEnd:
+		offset += d.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	d.pos = offset
+	return offset, nil
+}
+
+func BenchmarkEncodeCompressed(b *testing.B) {
+	c, data := benchFixture()
+	c = c.Clone(false)
+	c.Header.Flags |= FlagGLBCompressed
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := c.WriteTo(io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestMetadataOnlyAllocs checks that reading just the header, or everything
+// but the GLB, costs a handful of allocations regardless of the GLB's size.
+// The limits are today's counts, so a regression fails here first
+func TestMetadataOnlyAllocs(t *testing.T) {
+	_, data := benchFixture()
+	r := bytes.NewReader(data)
+
+	header := testing.AllocsPerRun(100, func() {
+		r.Reset(data)
+		if _, err := DecodeHeader(r); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if header > 4 {
+		t.Errorf("DecodeHeader allocates %v times, want at most 4", header)
+	}
+
+	skip := testing.AllocsPerRun(100, func() {
+		r.Reset(data)
+		if _, _, _, _, err := DecodeWithOptions(r, DecodeOptions{SkipGLB: true}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if skip > 16 {
+		t.Errorf("decoding with SkipGLB allocates %v times, want at most 16", skip)
+	}
+}
@@ -0,0 +1,312 @@
+package ntsm
+
+import (
+	"fmt"
+	"math"
+)
+
+// Bounds estimates the box e's particles can reach, in the emitter's
+// space, for culling offscreen effects. Particles are assumed to leave
+// Position within SpreadAngle of Direction at up to the larger of
+// |VelocityMin| and |VelocityMax|, or else with a velocity between
+// VelocityMin and VelocityMax, whichever reaches further along each axis.
+// They then accelerate by Acceleration for at most ParticleLifetime, and the
+// box is padded by half the larger particle size
+func (e ParticleEmitter) Bounds() (min, max [3]float32) {
+	t := float64(e.ParticleLifetime)
+	speed := math.Max(length(e.VelocityMin), length(e.VelocityMax))
+	lo, hi := coneBounds(vec64(e.Direction), float64(e.SpreadAngle), speed*t)
+	for i := range 3 {
+		a, b := float64(e.VelocityMin[i])*t, float64(e.VelocityMax[i])*t
+		lo[i] = math.Min(lo[i], math.Min(a, b))
+		hi[i] = math.Max(hi[i], math.Max(a, b))
+	}
+
+	accel := e.Acceleration()
+	for i := range 3 {
+		drift := float64(accel[i]) * t * t / 2
+		lo[i] += math.Min(drift, 0)
+		hi[i] += math.Max(drift, 0)
+	}
+
+	pad := math.Max(float64(e.StartSize), float64(e.EndSize)) / 2
+	for i := range 3 {
+		min[i] = float32(float64(e.Position[i]) + lo[i] - pad)
+		max[i] = float32(float64(e.Position[i]) + hi[i] + pad)
+	}
+	return min, max
+}
+
+// coneBounds returns the box around the part of a ball of radius r, centred
+// on the origin, within angle of dir. A zero dir or an angle of π or more
+// is the whole ball
+func coneBounds(dir [3]float64, angle, r float64) (lo, hi [3]float64) {
+	n := math.Sqrt(dir[0]*dir[0] + dir[1]*dir[1] + dir[2]*dir[2])
+	for i := range 3 {
+		if n == 0 || angle >= math.Pi {
+			lo[i], hi[i] = -r, r
+			continue
+		}
+		// The cone reaches furthest along an axis on its edge nearest it,
+		// and the apex at the origin is always included
+		toAxis := math.Acos(math.Max(-1, math.Min(1, dir[i]/n)))
+		hi[i] = r * math.Max(0, math.Cos(math.Max(0, toAxis-angle)))
+		lo[i] = -r * math.Max(0, math.Cos(math.Max(0, math.Pi-toAxis-angle)))
+	}
+	return lo, hi
+}
+
+// SceneBounds returns the box enclosing the mesh, when its GLB records the
+// extent of its positions, and the Bounds of every emitter. Emitters are
+// taken to be in the model's space, as if a SpaceWorld model sat at the
+// origin. ok is false when there is neither a mesh extent nor an emitter
+func (c *Container) SceneBounds() (min, max [3]float32, ok bool) {
+	var b box
+	if lo, hi, found, err := GLBBounds(c.GLB); err == nil && found {
+		b.add(vec64(lo), vec64(hi))
+	}
+	for _, e := range c.Emitters {
+		lo, hi := e.Bounds()
+		b.add(vec64(lo), vec64(hi))
+	}
+	if !b.ok {
+		return min, max, false
+	}
+	for i := range 3 {
+		min[i], max[i] = float32(b.min[i]), float32(b.max[i])
+	}
+	return min, max, true
+}
+
+// maxNodeVisits bounds the nodes GLBBounds visits, counting a shared node
+// once per path to it
+const maxNodeVisits = 1 << 20
+
+// GLBBounds returns the box enclosing the GLB's default scene, from the min
+// and max its POSITION accessors record, transformed by the scene's nodes.
+// found is false when no mesh in the scene records them
+func GLBBounds(glb []byte) (min, max [3]float32, found bool, err error) {
+	var doc struct {
+		Scene  *int `json:"scene"`
+		Scenes []struct {
+			Nodes []int `json:"nodes"`
+		} `json:"scenes"`
+		Nodes []struct {
+			Mesh        *int      `json:"mesh"`
+			Children    []int     `json:"children"`
+			Matrix      []float64 `json:"matrix"`
+			Translation []float64 `json:"translation"`
+			Rotation    []float64 `json:"rotation"`
+			Scale       []float64 `json:"scale"`
+		} `json:"nodes"`
+		Meshes []struct {
+			Primitives []struct {
+				Attributes map[string]int `json:"attributes"`
+			} `json:"primitives"`
+		} `json:"meshes"`
+		Accessors []struct {
+			Min []float64 `json:"min"`
+			Max []float64 `json:"max"`
+		} `json:"accessors"`
+	}
+	if err := glbDocument(glb, &doc); err != nil {
+		return min, max, false, err
+	}
+
+	// meshBox is the extent of mesh i in its own space
+	meshBox := func(i int) (box, error) {
+		var b box
+		if i < 0 || i >= len(doc.Meshes) {
+			return b, fmt.Errorf("%w: mesh %d out of range", ErrInvalidGLB, i)
+		}
+		for _, p := range doc.Meshes[i].Primitives {
+			a, ok := p.Attributes["POSITION"]
+			if !ok {
+				continue
+			}
+			if a < 0 || a >= len(doc.Accessors) {
+				return b, fmt.Errorf("%w: accessor %d out of range", ErrInvalidGLB, a)
+			}
+			acc := doc.Accessors[a]
+			if len(acc.Min) == 3 && len(acc.Max) == 3 {
+				b.add([3]float64(acc.Min), [3]float64(acc.Max))
+			}
+		}
+		return b, nil
+	}
+
+	// A node shared by several parents is visited once per path to it, so
+	// count visits as well as tracking the nodes on the stack: nested shared
+	// children would otherwise make the walk exponential
+	var (
+		scene   box
+		onStack = make([]bool, len(doc.Nodes))
+		visits  int
+		walk    func(node int, parent mat4) error
+	)
+	walk = func(node int, parent mat4) error {
+		if node < 0 || node >= len(doc.Nodes) {
+			return fmt.Errorf("%w: node %d out of range", ErrInvalidGLB, node)
+		}
+		if onStack[node] {
+			return fmt.Errorf("%w: node %d is in a cycle", ErrInvalidGLB, node)
+		}
+		if visits++; visits > maxNodeVisits {
+			return fmt.Errorf("%w: scene expands to more than %d nodes", ErrInvalidGLB, maxNodeVisits)
+		}
+		onStack[node] = true
+		defer func() { onStack[node] = false }()
+		n := doc.Nodes[node]
+		local := trs(n.Translation, n.Rotation, n.Scale)
+		if len(n.Matrix) == 16 {
+			local = mat4(n.Matrix)
+		}
+		world := parent.mul(local)
+		if n.Mesh != nil {
+			b, err := meshBox(*n.Mesh)
+			if err != nil {
+				return err
+			}
+			if b.ok {
+				scene.addTransformed(b, world)
+			}
+		}
+		for _, child := range n.Children {
+			if err := walk(child, world); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var roots []int
+	switch {
+	case len(doc.Scenes) > 0:
+		s := 0
+		if doc.Scene != nil {
+			s = *doc.Scene
+		}
+		if s < 0 || s >= len(doc.Scenes) {
+			return min, max, false, fmt.Errorf("%w: scene %d out of range", ErrInvalidGLB, s)
+		}
+		roots = doc.Scenes[s].Nodes
+	default:
+		// Without scenes, every node that isn't a child is a root
+		child := make([]bool, len(doc.Nodes))
+		for _, n := range doc.Nodes {
+			for _, c := range n.Children {
+				if c >= 0 && c < len(child) {
+					child[c] = true
+				}
+			}
+		}
+		for i := range doc.Nodes {
+			if !child[i] {
+				roots = append(roots, i)
+			}
+		}
+	}
+	for _, root := range roots {
+		if err := walk(root, identity); err != nil {
+			return min, max, false, err
+		}
+	}
+
+	if !scene.ok {
+		return min, max, false, nil
+	}
+	for i := range 3 {
+		min[i], max[i] = float32(scene.min[i]), float32(scene.max[i])
+	}
+	return min, max, true, nil
+}
+
+// box is an axis-aligned bounding box, empty until ok
+type box struct {
+	min, max [3]float64
+	ok       bool
+}
+
+// add grows b to enclose the box from lo to hi
+func (b *box) add(lo, hi [3]float64) {
+	if !b.ok {
+		b.min, b.max, b.ok = lo, hi, true
+		return
+	}
+	for i := range 3 {
+		b.min[i] = math.Min(b.min[i], lo[i])
+		b.max[i] = math.Max(b.max[i], hi[i])
+	}
+}
+
+// addTransformed grows b to enclose o's corners transformed by m
+func (b *box) addTransformed(o box, m mat4) {
+	for corner := range 8 {
+		var p [3]float64
+		for i := range 3 {
+			p[i] = o.min[i]
+			if corner&(1<<i) != 0 {
+				p[i] = o.max[i]
+			}
+		}
+		p = m.apply(p)
+		b.add(p, p)
+	}
+}
+
+// mat4 is a column-major 4x4 matrix, as glTF stores them
+type mat4 [16]float64
+
+var identity = mat4{0: 1, 5: 1, 10: 1, 15: 1}
+
+func (m mat4) mul(o mat4) mat4 {
+	var r mat4
+	for col := range 4 {
+		for row := range 4 {
+			for k := range 4 {
+				r[col*4+row] += m[k*4+row] * o[col*4+k]
+			}
+		}
+	}
+	return r
+}
+
+func (m mat4) apply(p [3]float64) [3]float64 {
+	var r [3]float64
+	for row := range 3 {
+		r[row] = m[row]*p[0] + m[4+row]*p[1] + m[8+row]*p[2] + m[12+row]
+	}
+	return r
+}
+
+// trs returns the matrix for a glTF node's translation, rotation quaternion
+// (x, y, z, w) and scale, each optional
+func trs(t, r, s []float64) mat4 {
+	tx, ty, tz := 0., 0., 0.
+	if len(t) == 3 {
+		tx, ty, tz = t[0], t[1], t[2]
+	}
+	x, y, z, w := 0., 0., 0., 1.
+	if len(r) == 4 {
+		x, y, z, w = r[0], r[1], r[2], r[3]
+	}
+	sx, sy, sz := 1., 1., 1.
+	if len(s) == 3 {
+		sx, sy, sz = s[0], s[1], s[2]
+	}
+	return mat4{
+		(1 - 2*(y*y+z*z)) * sx, 2 * (x*y + z*w) * sx, 2 * (x*z - y*w) * sx, 0,
+		2 * (x*y - z*w) * sy, (1 - 2*(x*x+z*z)) * sy, 2 * (y*z + x*w) * sy, 0,
+		2 * (x*z + y*w) * sz, 2 * (y*z - x*w) * sz, (1 - 2*(x*x+y*y)) * sz, 0,
+		tx, ty, tz, 1,
+	}
+}
+
+func vec64(v [3]float32) [3]float64 {
+	return [3]float64{float64(v[0]), float64(v[1]), float64(v[2])}
+}
+
+func length(v [3]float32) float64 {
+	p := vec64(v)
+	return math.Sqrt(p[0]*p[0] + p[1]*p[1] + p[2]*p[2])
+}
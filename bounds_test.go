@@ -0,0 +1,115 @@
+package ntsm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// checkBox compares a box to the expected one, allowing for rounding
+func checkBox(t *testing.T, what string, min, max, wantMin, wantMax [3]float32) {
+	t.Helper()
+	for i := range 3 {
+		if math.Abs(float64(min[i]-wantMin[i])) > 1e-5 || math.Abs(float64(max[i]-wantMax[i])) > 1e-5 {
+			t.Errorf("%s = %v to %v, want %v to %v", what, min, max, wantMin, wantMax)
+			return
+		}
+	}
+}
+
+func TestEmitterBounds(t *testing.T) {
+	for _, tt := range []struct {
+		name             string
+		e                ParticleEmitter
+		wantMin, wantMax [3]float32
+	}{
+		{
+			"straight up",
+			ParticleEmitter{Position: [3]float32{1, 2, 3}, Direction: [3]float32{0, 1, 0}, VelocityMax: [3]float32{0, 5, 0}, ParticleLifetime: 2},
+			[3]float32{1, 2, 3}, [3]float32{1, 12, 3},
+		},
+		{
+			"hemisphere",
+			ParticleEmitter{Direction: [3]float32{0, 2, 0}, SpreadAngle: math.Pi / 2, VelocityMax: [3]float32{0, 1, 0}, ParticleLifetime: 1},
+			[3]float32{-1, 0, -1}, [3]float32{1, 1, 1},
+		},
+		{
+			"no direction",
+			ParticleEmitter{VelocityMin: [3]float32{0, 0, -2}, VelocityMax: [3]float32{1, 0, 0}, ParticleLifetime: 1},
+			[3]float32{-2, -2, -2}, [3]float32{2, 2, 2},
+		},
+		{
+			"falling, padded by size",
+			ParticleEmitter{Gravity: -2, ParticleLifetime: 1, StartSize: 2, EndSize: 1},
+			[3]float32{-1, -2, -1}, [3]float32{1, 1, 1},
+		},
+		{
+			"blown by wind, ignoring the scalar",
+			ParticleEmitter{Gravity: -2, GravityVec: [3]float32{4, 0, 0}, ParticleLifetime: 1},
+			[3]float32{0, 0, 0}, [3]float32{2, 0, 0},
+		},
+	} {
+		min, max := tt.e.Bounds()
+		checkBox(t, tt.name, min, max, tt.wantMin, tt.wantMax)
+	}
+}
+
+func TestGLBBounds(t *testing.T) {
+	// A rotated child under a translated root: the child's [0,1]x[0,2]x[0,3]
+	// box turns 90° about Z, then moves 10 along X
+	glb := testGLBJSON(`{"asset":{"version":"2.0"},"scene":0,"scenes":[{"nodes":[0]}],
+		"nodes":[{"translation":[10,0,0],"children":[1]},{"mesh":0,"rotation":[0,0,0.70710678,0.70710678]}],
+		"meshes":[{"primitives":[{"attributes":{"POSITION":0}}]}],
+		"accessors":[{"min":[0,0,0],"max":[1,2,3]}]}`)
+	min, max, found, err := GLBBounds(glb)
+	if err != nil || !found {
+		t.Fatalf("GLBBounds = %v, %v", found, err)
+	}
+	checkBox(t, "GLBBounds", min, max, [3]float32{8, 0, 0}, [3]float32{10, 1, 3})
+
+	if _, _, found, err := GLBBounds(testGLB()); found || err != nil {
+		t.Errorf("GLBBounds with no meshes = %v, %v, want not found", found, err)
+	}
+	cycle := testGLBJSON(`{"asset":{"version":"2.0"},"nodes":[{"children":[1]},{"children":[0]}],"scenes":[{"nodes":[0]}]}`)
+	if _, _, _, err := GLBBounds(cycle); err == nil {
+		t.Error("GLBBounds followed a node cycle without error")
+	}
+
+	// A node shared by two parents is not a cycle, and is counted once per
+	// parent
+	shared := testGLBJSON(`{"asset":{"version":"2.0"},"scenes":[{"nodes":[0]}],
+		"nodes":[{"children":[1,2]},{"translation":[-5,0,0],"children":[3]},{"translation":[5,0,0],"children":[3]},{"mesh":0}],
+		"meshes":[{"primitives":[{"attributes":{"POSITION":0}}]}],
+		"accessors":[{"min":[0,0,0],"max":[1,1,1]}]}`)
+	min, max, found, err = GLBBounds(shared)
+	if err != nil || !found {
+		t.Fatalf("GLBBounds of a shared child = %v, %v", found, err)
+	}
+	checkBox(t, "GLBBounds of a shared child", min, max, [3]float32{-5, 0, 0}, [3]float32{6, 1, 1})
+
+	// 64 levels of nodes each listing the next twice has 2^64 paths, which
+	// must fail quickly rather than be walked
+	var nodes []string
+	for i := range 63 {
+		nodes = append(nodes, fmt.Sprintf(`{"children":[%d,%d]}`, i+1, i+1))
+	}
+	nodes = append(nodes, `{"mesh":0}`)
+	dag := testGLBJSON(`{"asset":{"version":"2.0"},"scenes":[{"nodes":[0]}],"nodes":[` + strings.Join(nodes, ",") + `],
+		"meshes":[{"primitives":[{"attributes":{"POSITION":0}}]}],
+		"accessors":[{"min":[0,0,0],"max":[1,1,1]}]}`)
+	if _, _, _, err := GLBBounds(dag); !errors.Is(err, ErrInvalidGLB) {
+		t.Errorf("GLBBounds of an exponential DAG = %v, want ErrInvalidGLB", err)
+	}
+
+	c := &Container{GLB: glb, Emitters: []ParticleEmitter{{Position: [3]float32{0, 5, 0}, ParticleLifetime: 1}}}
+	min, max, ok := c.SceneBounds()
+	if !ok {
+		t.Fatal("SceneBounds found nothing")
+	}
+	checkBox(t, "SceneBounds", min, max, [3]float32{0, 0, 0}, [3]float32{10, 5, 3})
+	if _, _, ok := (&Container{GLB: testGLB()}).SceneBounds(); ok {
+		t.Error("SceneBounds of an empty scene is ok")
+	}
+}
@@ -0,0 +1,47 @@
+package ntsm
+
+import (
+	"maps"
+	"slices"
+)
+
+// Clone returns a copy of the header. Header holds only value types, so
+// this is the same as assignment; it exists so callers snapshotting state
+// don't need to know that
+func (h Header) Clone() Header {
+	return h
+}
+
+// CloneEmitters returns an independent copy of emitters, or nil if it is nil
+func CloneEmitters(emitters []ParticleEmitter) []ParticleEmitter {
+	return slices.Clone(emitters)
+}
+
+// Clone returns a copy of the container whose header, emitter, texture and
+// mesh slices and metadata can be modified without affecting c. The GLB,
+// texture and mesh byte slices are shared with c unless copyData is set,
+// since they are usually large and rarely edited in place
+func (c *Container) Clone(copyData bool) *Container {
+	clone := &Container{
+		Header:   c.Header.Clone(),
+		GLB:      c.GLB,
+		Emitters: CloneEmitters(c.Emitters),
+		Textures: slices.Clone(c.Textures),
+		Meshes:   slices.Clone(c.Meshes),
+
+		thumbnail: c.thumbnail,
+		meta:      maps.Clone(c.meta),
+		size:      c.size,
+	}
+	if copyData {
+		clone.GLB = slices.Clone(c.GLB)
+		clone.thumbnail = slices.Clone(c.thumbnail)
+		for i := range clone.Textures {
+			clone.Textures[i].Data = slices.Clone(clone.Textures[i].Data)
+		}
+		for i := range clone.Meshes {
+			clone.Meshes[i].Data = slices.Clone(clone.Meshes[i].Data)
+		}
+	}
+	return clone
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/netisu/ntsm"
+)
+
+func main() {
+	quiet := flag.Bool("q", false, "Only report whether the files differ")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-q] <old.ntsm> <new.ntsm>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	// Exit 2 on errors, like diff, so 1 always means the files differ
+	log.SetFlags(0)
+	a, err := readFile(flag.Arg(0))
+	if err != nil {
+		log.Printf("%s: %v", flag.Arg(0), err)
+		os.Exit(2)
+	}
+	b, err := readFile(flag.Arg(1))
+	if err != nil {
+		log.Printf("%s: %v", flag.Arg(1), err)
+		os.Exit(2)
+	}
+
+	d := ntsm.Diff(a, b)
+	if d.Equal() {
+		return
+	}
+	if *quiet {
+		fmt.Printf("%s and %s differ\n", flag.Arg(0), flag.Arg(1))
+	} else {
+		fmt.Printf("--- %s\n+++ %s\n", flag.Arg(0), flag.Arg(1))
+		for _, c := range d.Changes {
+			fmt.Printf("  %s\n", c)
+		}
+		fmt.Printf("%d differences\n", len(d.Changes))
+	}
+	os.Exit(1)
+}
+
+func readFile(path string) (*ntsm.Container, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var c ntsm.Container
+	if _, err := c.ReadFrom(f); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/netisu/ntsm"
+)
+
+func main() {
+	glbOut := flag.String("glb", "", "Write the GLB to this file; the first level of detail of a multi-mesh file")
+	particlesOut := flag.String("particles", "", "Write the emitters to this file as JSON")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-glb out.glb] [-particles out.json] <file.ntsm>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 || *glbOut == "" && *particlesOut == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+
+	if err := extract(path, *glbOut, *particlesOut); err != nil {
+		log.Fatalf("%s: %v", path, err)
+	}
+}
+
+// extract writes the GLB of the NTSM file at path to glbOut and its
+// emitters to particlesOut, skipping either when empty
+func extract(path, glbOut, particlesOut string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := ntsm.DecodeHeader(io.NewSectionReader(f, 0, ntsm.HeaderSize))
+	if err != nil {
+		return err
+	}
+	if err := hdr.Validate(info.Size()); err != nil {
+		return err
+	}
+
+	if glbOut != "" {
+		if err := extractGLB(f, hdr, glbOut); err != nil {
+			return fmt.Errorf("extracting GLB: %w", err)
+		}
+	}
+	if particlesOut != "" {
+		if err := extractParticles(f, hdr, particlesOut); err != nil {
+			return fmt.Errorf("extracting particles: %w", err)
+		}
+	}
+	return nil
+}
+
+// extractGLB copies the GLB region to path, streaming it unless it has to
+// be decompressed first
+func extractGLB(r io.ReaderAt, hdr *ntsm.Header, path string) error {
+	var src io.Reader
+	if hdr.IsCompressed() {
+		glb, err := hdr.OpenValidatedGLB(r)
+		if err != nil {
+			return err
+		}
+		src = bytes.NewReader(glb)
+	} else {
+		sr, err := ntsm.OpenGLB(r, hdr)
+		if err != nil {
+			return err
+		}
+		src = sr
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// extractParticles writes the emitters to path as a JSON array, in the
+// format ntsm-migrate reads from .particles.json files
+func extractParticles(r io.ReaderAt, hdr *ntsm.Header, path string) error {
+	emitters := []ntsm.ParticleEmitter{}
+	for e, err := range hdr.EmitterSeq(r) {
+		if err != nil {
+			return err
+		}
+		emitters = append(emitters, e)
+	}
+	data, err := json.MarshalIndent(emitters, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/netisu/ntsm"
+)
+
+func TestExtract(t *testing.T) {
+	glb, err := os.ReadFile(filepath.Join("..", "ntsm-migrate", "test.glb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	emitters := []ntsm.ParticleEmitter{
+		{EmissionRate: 10, ParticleLifetime: 2, TextureIndex: -1, StartColor: [4]float32{1, 0.5, 0, 1}},
+		{BurstCount: 20, TextureIndex: -1, GroupID: 1},
+	}
+
+	dir := t.TempDir()
+	for _, compression := range []ntsm.Compression{ntsm.CompressionNone, ntsm.CompressionDeflate} {
+		var buf bytes.Buffer
+		var hdr ntsm.Header
+		hdr.SetName("sword")
+		if err := ntsm.EncodeWithOptions(&buf, &hdr, glb, emitters, nil, ntsm.EncodeOptions{Compression: compression}); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, "sword.ntsm")
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		glbOut, particlesOut := filepath.Join(dir, "sword.glb"), filepath.Join(dir, "sword.particles.json")
+		if err := extract(path, glbOut, particlesOut); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(glbOut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(got, []byte("glTF")) || !bytes.Equal(got, glb) {
+			t.Errorf("compression %v: extracted %d bytes starting %q, want the %d-byte source GLB", compression, len(got), got[:min(4, len(got))], len(glb))
+		}
+
+		f, err := os.Open(particlesOut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := ntsm.ReadEmittersJSON(f)
+		f.Close()
+		if err != nil || !reflect.DeepEqual(decoded, emitters) {
+			t.Errorf("compression %v: extracted emitters %+v, %v", compression, decoded, err)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/netisu/ntsm"
+)
+
+// info is the metadata reported for a single file
+type info struct {
+	Path          string `json:"path"`
+	Name          string `json:"name,omitempty"`
+	Version       uint32 `json:"version,omitempty"`
+	Flags         string `json:"flags,omitempty"`
+	FileSize      int64  `json:"fileSize"`
+	GLBSize       uint32 `json:"glbSize"`
+	ParticleCount uint32 `json:"particleCount"`
+	TextureCount  uint32 `json:"textureCount"`
+	Checksum      string `json:"checksum,omitempty"`
+	Attribution   string `json:"attribution,omitempty"`
+	HeaderHex     string `json:"headerHex,omitempty"` // Raw header bytes, with -hex
+	Error         string `json:"error,omitempty"`
+
+	raw []byte // Raw header bytes, with -hex
+}
+
+func main() {
+	jsonOut := flag.Bool("json", false, "Print results as a JSON array")
+	hexOut := flag.Bool("hex", false, "Also dump the raw header bytes, even when the header is invalid")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-json] [-hex] <file.ntsm|glob>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	paths, err := expandArgs(flag.Args())
+	if err != nil {
+		log.Fatalf("Invalid pattern: %v", err)
+	}
+
+	results := make([]info, 0, len(paths))
+	failed := false
+	for _, path := range paths {
+		inf := readInfo(path, *hexOut)
+		if inf.Error != "" {
+			failed = true
+		}
+		results = append(results, inf)
+	}
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			log.Fatalf("Failed to write JSON: %v", err)
+		}
+	} else {
+		for i, inf := range results {
+			if i > 0 {
+				fmt.Println()
+			}
+			printInfo(inf)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// expandArgs expands glob patterns, keeping arguments that match nothing so
+// they are reported as missing
+func expandArgs(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			matches = []string{arg}
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// readInfo reads the header of path, and with raw its bytes as stored.
+// Only the header and metadata are read, so this is cheap even for large
+// files
+func readInfo(path string, raw bool) info {
+	inf := info{Path: path}
+
+	f, err := os.Open(path)
+	if err != nil {
+		inf.Error = err.Error()
+		return inf
+	}
+	defer f.Close()
+
+	if raw {
+		// ReadAt leaves the offset for DecodeHeader; a short file dumps what there is
+		buf := make([]byte, ntsm.HeaderSize)
+		n, _ := io.ReadFull(io.NewSectionReader(f, 0, ntsm.HeaderSize), buf)
+		inf.raw = buf[:n]
+		inf.HeaderHex = hex.EncodeToString(inf.raw)
+	}
+
+	hdr, err := ntsm.DecodeHeader(f)
+	if err != nil {
+		inf.Error = err.Error()
+		return inf
+	}
+	st, err := f.Stat()
+	if err != nil {
+		inf.Error = err.Error()
+		return inf
+	}
+
+	stats := hdr.Stats(st.Size())
+	inf.Name = hdr.NameString()
+	inf.Version = hdr.Version
+	inf.Flags = hdr.Flags.String()
+	inf.FileSize = stats.FileSize
+	inf.GLBSize = stats.GLBSize
+	inf.ParticleCount = uint32(stats.EmitterCount)
+	inf.TextureCount = uint32(stats.TextureCount)
+	inf.Checksum = "none"
+	if stats.HasChecksum {
+		inf.Checksum = fmt.Sprintf("crc32:%08x", hdr.Checksum)
+	}
+
+	meta, err := ntsm.ReadMeta(f)
+	if err != nil {
+		inf.Error = err.Error()
+		return inf
+	}
+	inf.Attribution = meta[ntsm.MetaAttribution]
+	return inf
+}
+
+func printInfo(inf info) {
+	fmt.Printf("%s\n", inf.Path)
+	defer printHex(inf.raw)
+	if inf.Error != "" {
+		fmt.Printf("  Error:     %s\n", inf.Error)
+		return
+	}
+	fmt.Printf("  Name:      %s\n", inf.Name)
+	fmt.Printf("  Version:   %d\n", inf.Version)
+	fmt.Printf("  Flags:     %s\n", inf.Flags)
+	fmt.Printf("  File size: %d bytes\n", inf.FileSize)
+	fmt.Printf("  GLB size:  %d bytes\n", inf.GLBSize)
+	fmt.Printf("  Particles: %d\n", inf.ParticleCount)
+	fmt.Printf("  Textures:  %d\n", inf.TextureCount)
+	fmt.Printf("  Checksum:  %s\n", inf.Checksum)
+	if inf.Attribution != "" {
+		fmt.Printf("  Attribution: %s\n", inf.Attribution)
+	}
+}
+
+// printHex dumps raw header bytes, indented under the file's fields
+func printHex(raw []byte) {
+	if len(raw) == 0 {
+		return
+	}
+	fmt.Println("  Header:")
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(hex.Dump(raw), "\n"), "\n") {
+		fmt.Printf("    %s", line)
+	}
+	fmt.Println()
+}
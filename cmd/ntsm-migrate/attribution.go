@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// loadAttributions reads an -attribution-file: a JSON object mapping item
+// names, as embedded in the header, to the attribution to embed for them
+func loadAttributions(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var attributions map[string]string
+	if err := json.Unmarshal(data, &attributions); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return attributions, nil
+}
+
+// attributionFor returns the attribution to embed for the item named name:
+// its -attribution-file entry, else -attribution, else nothing
+func attributionFor(name string, opts options) string {
+	if text, ok := opts.attributions[name]; ok {
+		return text
+	}
+	return opts.attribution
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// memBudget limits the estimated memory held by in-flight conversions.
+// A nil budget never blocks
+type memBudget struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int64
+	used  int64
+}
+
+func newMemBudget(limit int64) *memBudget {
+	if limit <= 0 {
+		return nil
+	}
+	b := &memBudget{limit: limit}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// errOverBudget is returned for a file whose estimated cost alone exceeds
+// the budget, which could never be converted within it
+var errOverBudget = errors.New("[worker] estimated memory exceeds -max-mem")
+
+// acquire blocks until cost fits in the budget or ctx is done, calling
+// wait first if it has to block. A cost above the whole limit fails with
+// errOverBudget rather than waiting forever
+func (b *memBudget) acquire(ctx context.Context, cost int64, wait func()) (int64, error) {
+	if b == nil || cost <= 0 {
+		return 0, ctx.Err()
+	}
+	if cost > b.limit {
+		return 0, fmt.Errorf("%w: %d bytes, budget is %d", errOverBudget, cost, b.limit)
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.cond.Broadcast()
+	})
+	defer stop()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.used+cost > b.limit && wait != nil {
+		wait()
+	}
+	for b.used+cost > b.limit {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		b.cond.Wait()
+	}
+	b.used += cost
+	return cost, nil
+}
+
+// release returns cost acquired earlier to the budget
+func (b *memBudget) release(cost int64) {
+	if b == nil || cost <= 0 {
+		return
+	}
+	b.mu.Lock()
+	b.used -= cost
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// estimateCost guesses the peak memory converting file will hold, from its
+// size on disk. GLBs passed through the streaming encoder cost next to
+// nothing; everything else is buffered whole, plus a compressed copy with
+// -compress and the decoded mesh with -thumbnail
+func estimateCost(file string, opts options) int64 {
+	info, err := os.Stat(file)
+	if err != nil {
+		return 0
+	}
+	ext := strings.ToLower(filepath.Ext(file))
+	if ext != ".obj" && ext != ".gltf" && !opts.compress && !opts.thumbnail {
+		return 0
+	}
+
+	copies := int64(1)
+	if opts.compress {
+		copies++
+	}
+	if opts.thumbnail {
+		copies++
+	}
+	return info.Size() * copies
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/netisu/ntsm"
+)
+
+// objGLBRatio is roughly how large obj2gltf's binary output is relative to
+// the OBJ text it reads
+const objGLBRatio = 0.5
+
+// byteCounter is a writer that only counts, used to size dry-run output
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
+
+// estimateOutputSize guesses the .ntsm size for srcPath without running
+// obj2gltf, for -dry-run-fast. OBJs are sized at objGLBRatio of the source,
+// glTF files are packed in memory as usual, and -compress and -thumbnail
+// aren't accounted for
+func estimateOutputSize(srcPath string) (int64, error) {
+	var glbSize int64
+	switch strings.ToLower(filepath.Ext(srcPath)) {
+	case ".gltf":
+		glb, err := gltfToGLB(srcPath)
+		if err != nil {
+			return 0, fmt.Errorf("[worker] glTF conversion failed: %w", err)
+		}
+		glbSize = int64(len(glb))
+	default:
+		info, err := os.Stat(srcPath)
+		if err != nil {
+			return 0, fmt.Errorf("[worker] stat failed: %w", err)
+		}
+		glbSize = info.Size()
+	}
+	isOBJ := strings.EqualFold(filepath.Ext(srcPath), ".obj")
+	if isOBJ {
+		glbSize = int64(float64(glbSize) * objGLBRatio)
+	}
+
+	emitters, err := loadParticleSidecar(srcPath)
+	if err != nil {
+		return 0, err
+	}
+	var textures []ntsm.Texture
+	if isOBJ {
+		if textures, err = applyMaterials(srcPath, emitters); err != nil {
+			return 0, err
+		}
+	}
+
+	size := ntsm.HeaderSize + glbSize + int64(ntsm.EncodedParticleSize(emitters))
+	for _, t := range textures {
+		size += int64(binary.Size(ntsm.TextureEntry{})) + int64(len(t.Data))
+	}
+	return size, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/qmuntal/gltf"
+	"github.com/qmuntal/gltf/modeler"
+)
+
+// gltfToGLB packs a .gltf file into a self-contained GLB. Buffers and images
+// referenced by relative URI are read from beside the file; remote or
+// absolute URIs, and any leading out of its directory, are rejected
+func gltfToGLB(srcPath string) ([]byte, error) {
+	doc, err := gltf.Open(srcPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %w", srcPath, err)
+	}
+
+	mergeBuffers(doc)
+	if err := embedImages(doc, filepath.Dir(srcPath)); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := gltf.NewEncoder(&buf).Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mergeBuffers concatenates every buffer into the first, since a GLB has a
+// single binary chunk, and repoints the buffer views
+func mergeBuffers(doc *gltf.Document) {
+	if len(doc.Buffers) == 0 {
+		return
+	}
+
+	merged := &gltf.Buffer{}
+	offsets := make([]int, len(doc.Buffers))
+	for i, b := range doc.Buffers {
+		// Buffer views may need 4-byte aligned data
+		for len(merged.Data)%4 != 0 {
+			merged.Data = append(merged.Data, 0)
+		}
+		offsets[i] = len(merged.Data)
+		merged.Data = append(merged.Data, b.Data...)
+	}
+	merged.ByteLength = len(merged.Data)
+
+	for _, bv := range doc.BufferViews {
+		bv.ByteOffset += offsets[bv.Buffer]
+		bv.Buffer = 0
+	}
+	doc.Buffers = []*gltf.Buffer{merged}
+}
+
+// embedImages moves images referenced by file URI into buffer views. The
+// images are read through os.DirFS like the buffers gltf.Open loads, so a
+// URI such as "../../etc/passwd" can't reach outside dir
+func embedImages(doc *gltf.Document, dir string) error {
+	for i, img := range doc.Images {
+		if img.URI == "" || img.IsEmbeddedResource() {
+			continue
+		}
+
+		uri, err := url.PathUnescape(img.URI)
+		if err != nil || strings.Contains(uri, ":") || !fs.ValidPath(uri) {
+			return fmt.Errorf("image %d: unresolvable URI %q", i, img.URI)
+		}
+
+		mimeType := img.MimeType
+		if mimeType == "" {
+			switch strings.ToLower(filepath.Ext(uri)) {
+			case ".png":
+				mimeType = "image/png"
+			case ".jpg", ".jpeg":
+				mimeType = "image/jpeg"
+			default:
+				return fmt.Errorf("image %d: unknown image type for %q", i, img.URI)
+			}
+		}
+
+		data, err := fs.ReadFile(os.DirFS(dir), uri)
+		if err != nil {
+			return fmt.Errorf("image %d: %w", i, err)
+		}
+
+		view := modeler.WriteBufferView(doc, gltf.TargetNone, data)
+		img.BufferView = gltf.Index(view)
+		img.MimeType = mimeType
+		img.URI = ""
+	}
+	return nil
+}
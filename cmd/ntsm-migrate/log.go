@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"time"
+)
+
+// eventLog receives the events of a migration: the plan before it starts,
+// each file's outcome, and the summary. textLog prints them for people and
+// jsonLog as one JSON object per event for log aggregators
+type eventLog interface {
+	reporter
+	start(files []string, opts options)
+	summary(r results, elapsed time.Duration, opts options)
+}
+
+// textLog prints events as the default human-readable output, with skipped,
+// cancelled and converted files only listed under -verbose
+type textLog struct {
+	opts options
+}
+
+func (l textLog) start(files []string, opts options) {
+	fmt.Printf("Found %d assets to convert:\n", len(files))
+	for i, f := range files {
+		if i < 10 || i >= len(files)-5 {
+			fmt.Printf("  %s\n", f)
+		} else if i == 10 {
+			fmt.Printf("  ...\n")
+		}
+	}
+	fmt.Printf("\nSource: %s\n", opts.srcDir)
+	fmt.Printf("Destination: %s\n", opts.dstDir)
+	fmt.Printf("Concurrency: %d workers\n", opts.concurrency)
+	if opts.maxMem > 0 {
+		fmt.Printf("Memory budget: %d bytes\n", opts.maxMem)
+	}
+	if opts.timeout > 0 {
+		fmt.Printf("Timeout: %v per file\n", opts.timeout)
+	}
+	if opts.compress {
+		fmt.Println("Compression: deflate")
+	}
+	if opts.thumbnail {
+		fmt.Println("Thumbnails: 128x128 PNG")
+	}
+	if opts.textures.Format != "" {
+		fmt.Printf("Textures: transcoded to %s\n", opts.textures.Format)
+	}
+	if opts.attribution != "" || len(opts.attributions) > 0 {
+		fmt.Printf("Attribution: %d from -attribution-file, default %q\n", len(opts.attributions), opts.attribution)
+	}
+	if opts.incremental {
+		fmt.Println("Mode: incremental (up-to-date outputs are skipped)")
+	}
+	if opts.noClobber {
+		fmt.Println("Mode: no-clobber (existing outputs are skipped)")
+	}
+	if opts.flatten && !opts.singleFile {
+		fmt.Println("Layout: flat (subdirectories are dropped)")
+	}
+	if opts.dryRunFast {
+		fmt.Println("Mode: FAST DRY RUN (sizes estimated, no files will be written)")
+	} else if opts.dryRun {
+		fmt.Println("Mode: DRY RUN (no files will be written)")
+	}
+}
+
+func (l textLog) done(e manifestEntry, err error, size int64) {
+	rel := relPath(e.Source, l.opts)
+	switch e.Status {
+	case statusDryRun:
+		fmt.Printf("[dry-run] %s: %d bytes\n", rel, size)
+	case statusFailed:
+		if l.opts.verbose {
+			fmt.Printf("Failed: %v\n", err)
+		}
+		return
+	case statusCancelled:
+		// Only files cancelled mid-conversion are worth a line
+		if l.opts.verbose && err != nil {
+			fmt.Printf("Cancelled: %s\n", rel)
+		}
+		return
+	}
+	if !l.opts.verbose {
+		return
+	}
+	switch e.Status {
+	case statusSkipped:
+		fmt.Printf("Skipped (up to date): %s\n", rel)
+	case statusExists:
+		fmt.Printf("Skipped (output exists): %s\n", rel)
+	case statusConverted, statusDryRun:
+		fmt.Printf("Converted: %s\n", rel)
+	}
+}
+
+func (l textLog) summary(r results, elapsed time.Duration, opts options) {
+	fmt.Printf("\nMigration completed in %v\n", elapsed.Truncate(time.Millisecond))
+	fmt.Printf("✓ Successfully converted: %d\n", r.success)
+	fmt.Printf("✗ Failed: %d\n", r.failed)
+	if r.timedOut > 0 {
+		fmt.Printf("  of which timed out: %d\n", r.timedOut)
+	}
+	fmt.Printf("↷ Skipped (up to date): %d\n", r.skipped)
+	if opts.noClobber {
+		fmt.Printf("↷ Skipped (output exists): %d\n", r.clobbered)
+	}
+	if r.cancelled > 0 {
+		fmt.Printf("⊘ Cancelled: %d\n", r.cancelled)
+	}
+	if opts.dryRunFast {
+		fmt.Printf("Estimated output size: %d bytes\n", r.bytes)
+	} else if opts.dryRun {
+		fmt.Printf("Output size: %d bytes\n", r.bytes)
+	}
+
+	if opts.manifest != "" {
+		fmt.Printf("Manifest: %s\n", opts.manifest)
+	}
+
+	if r.failed > 0 && !opts.dryRun {
+		fmt.Println("\nTip: Check logs for details on failed conversions.")
+		fmt.Println("You can retry individual files with: ntsm-migrate -src <file> -dst <file.ntsm>")
+	}
+}
+
+// jsonLog writes each event as a JSON object on its own line
+type jsonLog struct {
+	log *slog.Logger
+}
+
+func newJSONLog(w io.Writer) jsonLog {
+	return jsonLog{slog.New(slog.NewJSONHandler(w, nil))}
+}
+
+func (l jsonLog) start(files []string, opts options) {
+	l.log.Info("start",
+		"files", len(files),
+		"src", opts.srcDir,
+		"dst", opts.dstDir,
+		"concurrency", opts.concurrency,
+		"dryRun", opts.dryRun,
+	)
+}
+
+func (l jsonLog) done(e manifestEntry, err error, size int64) {
+	attrs := []any{"source", e.Source, "dest", e.Dest, "status", e.Status, "bytes", size}
+	if err != nil {
+		attrs = append(attrs, "error", err.Error())
+	}
+	level := slog.LevelInfo
+	if e.Status == statusFailed {
+		level = slog.LevelError
+	}
+	l.log.Log(context.Background(), level, "file", attrs...)
+}
+
+func (l jsonLog) summary(r results, elapsed time.Duration, opts options) {
+	l.log.Info("summary",
+		"converted", r.success,
+		"failed", r.failed,
+		"timedOut", r.timedOut,
+		"skipped", r.skipped,
+		"exists", r.clobbered,
+		"cancelled", r.cancelled,
+		"bytes", r.bytes,
+		"seconds", elapsed.Seconds(),
+	)
+}
+
+// relPath returns file relative to -src for display, or as given in
+// single-file mode
+func relPath(file string, opts options) string {
+	rel, err := filepath.Rel(opts.srcDir, file)
+	if err != nil || opts.singleFile {
+		return file
+	}
+	return rel
+}
@@ -2,104 +2,208 @@ package main
 
 import (
 	"bufio"
-	"encoding/binary"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
-)
+	"unicode/utf8"
 
-const (
-	HeaderSize = 192 // Fixed header size in bytes
+	"github.com/netisu/ntsm"
 )
 
-// NTSMHeader represents the binary header of the NTSM file format
-type NTSMHeader struct {
-	Magic          [4]byte // "NTSM"
-	Version        uint32  // Format version (1)
-	Name           [128]byte
-	Flags          uint8    // Bitfield: bit 0 = has_particles
-	_              [3]byte  // Padding
-	GLBOffset      uint32   // Offset to GLB data
-	GLBSize        uint32   // Size of GLB data
-	ParticleOffset uint32   // Offset to particle data
-	ParticleSize   uint32   // Size of particle data
-	TextureCount   uint32   // Number of embedded textures
-	TextureOffset  uint32   // Offset to texture table
-	_              [28]byte // Padding
+// options holds the parsed command-line flags shared by the workers
+type options struct {
+	srcDir       string
+	dstDir       string
+	singleFile   bool // srcDir names a single source file
+	concurrency  int
+	maxMem       int64         // Estimated bytes in flight across workers; 0 is unlimited
+	timeout      time.Duration // Per-file conversion deadline; 0 is none
+	dryRun       bool
+	dryRunFast   bool // Estimate sizes instead of converting; implies dryRun
+	verbose      bool
+	compress     bool
+	textures     ntsm.TextureOptions // How to transcode embedded MTL textures
+	thumbnail    bool
+	incremental  bool
+	noClobber    bool              // Skip files whose output already exists
+	keepGoing    bool              // Exit 0 even if some files fail
+	name         string            // Header name in single-file mode
+	template     string            // Header name template in batch mode
+	attribution  string            // Attribution to embed in every file, if any
+	attributions map[string]string // Item name to attribution, from -attribution-file
+	include      patternList
+	exclude      patternList
+	exts         []string          // Recognized source extensions, with the dot
+	manifest     string            // Path of the JSON manifest to write, if any
+	flatten      bool              // Write every output directly under dstDir
+	onCollision  string            // With flatten, "number" or "error" for duplicate stems
+	flat         map[string]string // Source file to output path, with flatten
 }
 
-// ParticleEmitter represents a single particle system configuration
-type ParticleEmitter struct {
-	Position         [3]float32
-	Direction        [3]float32
-	SpreadAngle      float32
-	EmissionRate     float32
-	ParticleLifetime float32
-	StartSize        float32
-	EndSize          float32
-	StartColor       [4]float32
-	EndColor         [4]float32
-	VelocityMin      [3]float32
-	VelocityMax      [3]float32
-	Gravity          float32
-	TextureIndex     int32
-	BlendMode        uint8
-	Loop             uint8
-	_                [2]byte
+// patternList is a repeatable glob flag
+type patternList []string
+
+func (p *patternList) String() string { return strings.Join(*p, ",") }
+
+func (p *patternList) Set(v string) error {
+	if _, err := path.Match(v, ""); err != nil {
+		return fmt.Errorf("bad pattern %q: %w", v, err)
+	}
+	*p = append(*p, v)
+	return nil
 }
 
 func main() {
-	srcDir := flag.String("src", "./uploads", "Source directory containing .obj/.glb files")
-	dstDir := flag.String("dst", "./uploads-ntsm", "Destination directory for .ntsm files")
-	concurrency := flag.Int("concurrency", 4, "Number of concurrent conversions")
-	dryRun := flag.Bool("dry-run", false, "Preview conversions without writing files")
-	verbose := flag.Bool("verbose", false, "Enable verbose logging")
+	var opts options
+	flag.StringVar(&opts.srcDir, "src", "./uploads", "Source directory containing .obj/.glb/.gltf files, or a single file")
+	flag.StringVar(&opts.dstDir, "dst", "./uploads-ntsm", "Destination directory for .ntsm files, or a .ntsm path when -src is a file")
+	flag.IntVar(&opts.concurrency, "concurrency", 4, "Number of concurrent conversions")
+	flag.DurationVar(&opts.timeout, "timeout", 0, "Fail any single conversion that takes longer than this, e.g. 2m (0 is no limit)")
+	flag.Int64Var(&opts.maxMem, "max-mem", 0, "Memory budget in bytes shared by the workers, estimated from file sizes; files estimated above it fail (0 is unlimited)")
+	flag.BoolVar(&opts.dryRun, "dry-run", false, "Convert without writing files, reporting the size each .ntsm would be")
+	flag.BoolVar(&opts.dryRunFast, "dry-run-fast", false, "Like -dry-run, but estimate sizes from the sources without converting OBJs")
+	flag.BoolVar(&opts.verbose, "verbose", false, "Enable verbose logging")
+	showProgress := flag.Bool("progress", false, "Show a single updating line with batch progress and an ETA")
+	logFormat := flag.String("log-format", "text", "Log events as text, or as json objects on stderr, one per line")
 	confirm := flag.Bool("yes", false, "Skip confirmation prompt")
+	flag.BoolVar(&opts.compress, "compress", false, "DEFLATE-compress the embedded GLB")
+	textureFormat := flag.String("texture-format", "", "Transcode embedded textures to png or jpeg")
+	flag.IntVar(&opts.textures.Quality, "texture-quality", 0, "JPEG quality for -texture-format, from 1 to 100 (0 is the default, 75)")
+	flag.BoolVar(&opts.textures.Force, "force-transcode", false, "Transcode textures that are already JPEG or in -texture-format")
+	flag.BoolVar(&opts.thumbnail, "thumbnail", false, "Render and embed a 128x128 PNG thumbnail")
+	flag.BoolVar(&opts.incremental, "incremental", false, "Skip files whose output is newer than the source")
+	flag.BoolVar(&opts.noClobber, "no-clobber", false, "Skip files whose output already exists instead of overwriting it")
+	force := flag.Bool("force", false, "Overwrite existing outputs (the default; conflicts with -no-clobber)")
+	flag.StringVar(&opts.name, "name", "", "Item name to embed (single-file mode only)")
+	flag.StringVar(&opts.template, "name-template", "{stem}", "Item name template for batch mode; {dir}, {stem} and {ext} are expanded")
+	flag.StringVar(&opts.attribution, "attribution", "", "License or attribution text to embed in each file's metadata")
+	attributionFile := flag.String("attribution-file", "", "JSON object mapping item names to attribution text, overriding -attribution")
+	flag.Var(&opts.include, "include", "Only convert files matching this glob (repeatable); patterns without a / match the file name")
+	flag.Var(&opts.exclude, "exclude", "Skip files matching this glob (repeatable); takes precedence over -include")
+	flag.StringVar(&opts.manifest, "manifest", "", "Write a JSON manifest of every conversion to this path")
+	flag.BoolVar(&opts.flatten, "flatten", false, "Write every output directly under -dst instead of mirroring subdirectories")
+	flag.StringVar(&opts.onCollision, "on-collision", "number", "With -flatten, how to handle files with the same stem: number or error")
+	flag.BoolVar(&opts.keepGoing, "keep-going", false, "Exit with status 0 even if some files fail to convert")
+	extraExts := flag.String("ext", "", "Comma-separated extra extensions to read as GLB, e.g. .vrm")
 	flag.Parse()
+	opts.dryRun = opts.dryRun || opts.dryRunFast
+	if *force && opts.noClobber {
+		log.Fatalf("-force and -no-clobber are mutually exclusive")
+	}
+	switch strings.ToLower(*textureFormat) {
+	case "":
+	case "png":
+		opts.textures.Format = "image/png"
+	case "jpg", "jpeg":
+		opts.textures.Format = "image/jpeg"
+	default:
+		log.Fatalf("-texture-format must be png or jpeg, not %q", *textureFormat)
+	}
+	if opts.textures.Quality < 0 || opts.textures.Quality > 100 {
+		log.Fatalf("-texture-quality must be from 1 to 100")
+	}
+	if !utf8.ValidString(opts.attribution) {
+		log.Fatalf("-attribution must be valid UTF-8")
+	}
+	if *attributionFile != "" {
+		attributions, err := loadAttributions(*attributionFile)
+		if err != nil {
+			log.Fatalf("Failed to read attribution file: %v", err)
+		}
+		opts.attributions = attributions
+	}
+	if *logFormat != "text" && *logFormat != "json" {
+		log.Fatalf("-log-format must be text or json, not %q", *logFormat)
+	}
+	if *logFormat == "json" && *showProgress {
+		log.Fatalf("-progress can't be combined with -log-format json")
+	}
+	if opts.onCollision != "number" && opts.onCollision != "error" {
+		log.Fatalf("-on-collision must be number or error, not %q", opts.onCollision)
+	}
+
+	opts.exts = []string{".obj", ".glb", ".gltf"}
+	for _, ext := range strings.Split(*extraExts, ",") {
+		if ext = strings.TrimSpace(ext); ext != "" {
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			opts.exts = append(opts.exts, strings.ToLower(ext))
+		}
+	}
 
 	// Check if obj2gltf is installed
 	if _, err := exec.LookPath("obj2gltf"); err != nil {
 		log.Fatalf("obj2gltf is not installed. Please install it with: bun install -g obj2gltf")
 	}
 
-	srcInfo, err := os.Stat(*srcDir)
-	if err != nil || !srcInfo.IsDir() {
-		log.Fatalf("Source directory does not exist: %s", *srcDir)
+	srcInfo, err := os.Stat(opts.srcDir)
+	if err != nil {
+		log.Fatalf("Source does not exist: %s", opts.srcDir)
 	}
 
-	if err := os.MkdirAll(*dstDir, 0755); err != nil {
-		log.Fatalf("Failed to create destination directory: %v", err)
-	}
+	var files []string
+	if srcInfo.IsDir() {
+		if err := os.MkdirAll(opts.dstDir, 0755); err != nil {
+			log.Fatalf("Failed to create destination directory: %v", err)
+		}
 
-	files, err := findSourceFiles(*srcDir)
-	if err != nil {
-		log.Fatalf("Failed to scan source directory: %v", err)
-	}
+		var filtered filterStats
+		files, filtered, err = findSourceFiles(opts)
+		if err != nil {
+			log.Fatalf("Failed to scan source directory: %v", err)
+		}
+		if opts.verbose && (len(opts.include) > 0 || len(opts.exclude) > 0) {
+			fmt.Printf("Filtered out %d files not matching -include, %d matching -exclude\n", filtered.notIncluded, filtered.excluded)
+		}
 
-	if len(files) == 0 {
-		log.Fatalf("No .obj or .glb files found in %s", *srcDir)
+		if len(files) == 0 {
+			log.Fatalf("No %s files found in %s", strings.Join(opts.exts, "/"), opts.srcDir)
+		}
+		if opts.name != "" {
+			log.Fatalf("-name only applies when -src is a single file; use -name-template")
+		}
+	} else {
+		if !isSourceFile(opts.srcDir, opts.exts) {
+			log.Fatalf("Source file is not a %s file: %s", strings.Join(opts.exts, "/"), opts.srcDir)
+		}
+		opts.singleFile = true
+		files = []string{opts.srcDir}
 	}
 
-	fmt.Printf("Found %d assets to convert:\n", len(files))
-	for i, f := range files {
-		if i < 10 || i >= len(files)-5 {
-			fmt.Printf("  %s\n", f)
-		} else if i == 10 {
-			fmt.Printf("  ...\n")
+	if opts.flatten && !opts.singleFile {
+		var collisions []collision
+		opts.flat, collisions = flattenPaths(files, opts)
+		for _, c := range collisions {
+			if opts.onCollision == "error" {
+				fmt.Printf("Collision: %s and %s both flatten to %s\n", c.file, c.with, c.want)
+			} else {
+				fmt.Printf("Collision: %s flattens to %s, taken by %s; writing %s\n", c.file, c.want, c.with, c.dst)
+			}
+		}
+		if len(collisions) > 0 && opts.onCollision == "error" {
+			log.Fatalf("%d files collide under -flatten; rename them, or use -on-collision=number", len(collisions))
 		}
 	}
-	fmt.Printf("\nSource: %s\n", *srcDir)
-	fmt.Printf("Destination: %s\n", *dstDir)
-	fmt.Printf("Concurrency: %d workers\n", *concurrency)
-	if *dryRun {
-		fmt.Println("Mode: DRY RUN (no files will be written)")
+
+	var events eventLog = textLog{opts}
+	if *logFormat == "json" {
+		events = newJSONLog(os.Stderr)
 	}
+	events.start(files, opts)
 
 	if !*confirm {
 		fmt.Print("\nProceed with migration? [y/N] ")
@@ -112,177 +216,624 @@ func main() {
 		}
 	}
 
+	// Ctrl-C stops queuing new files and aborts in-flight conversions
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	start := time.Now()
-	success, failed := processFiles(files, *srcDir, *dstDir, *concurrency, *dryRun, *verbose)
+	reporters := []reporter{events}
+	if *showProgress {
+		reporters = append(reporters, newProgressReporter(os.Stderr, len(files), 250*time.Millisecond))
+	}
+	r := processFiles(ctx, files, opts, reporters...)
 
-	duration := time.Since(start).Truncate(time.Millisecond)
-	fmt.Printf("\nMigration completed in %v\n", duration)
-	fmt.Printf("✓ Successfully converted: %d\n", success)
-	fmt.Printf("✗ Failed: %d\n", failed)
+	if opts.manifest != "" {
+		if err := writeManifest(opts.manifest, r.entries); err != nil {
+			log.Fatalf("Failed to write manifest: %v", err)
+		}
+	}
+	events.summary(r, time.Since(start), opts)
 
-	if failed > 0 && !*dryRun {
-		fmt.Println("\nTip: Check logs for details on failed conversions.")
-		fmt.Println("You can retry individual files with: ntsm-migrate -src <file> -dst <file.ntsm>")
+	// Failures fail a dry run too, since it converts the same way
+	if (r.failed > 0 && !opts.keepGoing) || r.cancelled > 0 {
+		os.Exit(1)
 	}
 }
 
-func findSourceFiles(dir string) ([]string, error) {
-	var files []string
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+// filterStats counts the source files dropped by -include and -exclude
+type filterStats struct {
+	notIncluded, excluded int
+}
+
+// findSourceFiles walks opts.srcDir for files with a recognized extension
+// that pass the -include and -exclude filters
+func findSourceFiles(opts options) ([]string, filterStats, error) {
+	var (
+		files []string
+		stats filterStats
+	)
+	err := filepath.Walk(opts.srcDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !isSourceFile(p, opts.exts) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(opts.srcDir, p)
 		if err != nil {
 			return err
 		}
-		if !info.IsDir() && (strings.HasSuffix(path, ".obj") || strings.HasSuffix(path, ".glb")) {
-			files = append(files, path)
+		rel = filepath.ToSlash(rel)
+		switch {
+		case matchAny(opts.exclude, rel):
+			stats.excluded++
+		case len(opts.include) > 0 && !matchAny(opts.include, rel):
+			stats.notIncluded++
+		default:
+			files = append(files, p)
 		}
 		return nil
 	})
-	return files, err
+	return files, stats, err
 }
 
-// processFiles converts multiple files with concurrency control
-func processFiles(files []string, srcDir, dstDir string, concurrency int, dryRun, verbose bool) (int, int) {
-	var (
-		wg      sync.WaitGroup
-		counter struct {
-			sync.Mutex
-			success, failed int
+// matchAny reports whether the slash-separated relative path rel matches
+// any pattern. Patterns without a slash are matched against the file name
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		target := rel
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(rel)
 		}
-	)
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
 
-	tasks := make(chan string, len(files))
+// isSourceFile reports whether p has one of the convertible extensions
+func isSourceFile(p string, exts []string) bool {
+	_, ext := splitExt(filepath.Base(p))
+	return slices.Contains(exts, strings.ToLower(ext))
+}
+
+// splitExt splits the file name base into its stem and final extension, so
+// "teapot.v2.obj" is "teapot.v2" and ".obj". A leading dot doesn't start an
+// extension: ".obj" is all stem
+func splitExt(base string) (stem, ext string) {
+	if i := strings.LastIndexByte(base, '.'); i > 0 {
+		return base[:i], base[i:]
+	}
+	return base, ""
+}
+
+// destPath returns the output path for a source file. In single-file mode a
+// -dst with a .ntsm extension (in any case, and without a trailing
+// separator) is used as-is; otherwise it is a directory
+func destPath(file string, opts options) string {
+	if dst, ok := opts.flat[file]; ok {
+		return dst
+	}
+	if opts.singleFile {
+		if strings.EqualFold(filepath.Ext(opts.dstDir), ".ntsm") {
+			return opts.dstDir
+		}
+		stem, _ := splitExt(filepath.Base(file))
+		return filepath.Join(opts.dstDir, stem+".ntsm")
+	}
+
+	relPath, err := filepath.Rel(opts.srcDir, file)
+	if err != nil {
+		relPath = file
+	}
+	dir, base := filepath.Split(relPath)
+	stem, _ := splitExt(base)
+	return filepath.Join(opts.dstDir, dir, stem+".ntsm")
+}
+
+// collision is a file whose output name under -flatten was already taken
+type collision struct {
+	file, with string // The file and the one that claimed its name first
+	want, dst  string // The name it would have had and, when numbered, its output
+}
+
+// flattenPaths maps each file to an output directly under opts.dstDir.
+// Outputs are compared ignoring case, since they may land on a
+// case-insensitive filesystem. The first file with a given stem keeps it and
+// later ones are numbered stem-2, stem-3 and so on, skipping names another
+// file already has; each renaming is returned as a collision
+func flattenPaths(files []string, opts options) (map[string]string, []collision) {
+	flat := make(map[string]string, len(files))
+	owner := make(map[string]string, len(files)) // Lowercased output name to its file
+	var dups []string
 	for _, file := range files {
-		tasks <- file
+		stem, _ := splitExt(filepath.Base(file))
+		key := strings.ToLower(stem + ".ntsm")
+		if _, ok := owner[key]; ok {
+			dups = append(dups, file)
+			continue
+		}
+		owner[key] = file
+		flat[file] = filepath.Join(opts.dstDir, stem+".ntsm")
+	}
+
+	var collisions []collision
+	for _, file := range dups {
+		stem, _ := splitExt(filepath.Base(file))
+		c := collision{file: file, with: owner[strings.ToLower(stem+".ntsm")], want: stem + ".ntsm"}
+		for n := 2; ; n++ {
+			name := fmt.Sprintf("%s-%d.ntsm", stem, n)
+			if _, ok := owner[strings.ToLower(name)]; !ok {
+				owner[strings.ToLower(name)] = file
+				c.dst = filepath.Join(opts.dstDir, name)
+				break
+			}
+		}
+		flat[file] = c.dst
+		collisions = append(collisions, c)
+	}
+	return flat, collisions
+}
+
+// results counts the outcome of each file
+type results struct {
+	success, failed, skipped, cancelled int
+	clobbered                           int             // Skipped by -no-clobber
+	timedOut                            int             // Failed by -timeout, included in failed
+	bytes                               int64           // Total would-be output size in dry runs
+	entries                             []manifestEntry // One per file, in input order
+}
+
+// errTimeout is returned by convertWithTimeout for a conversion that ran
+// past -timeout
+var errTimeout = errors.New("[worker] conversion timed out")
+
+// errClobber is returned by convertToNTSM when -no-clobber finds the output
+// already exists
+var errClobber = errors.New("[worker] output already exists")
+
+// processFiles converts multiple files with concurrency control, telling
+// each reporter of every outcome. Files not yet started when ctx is done are
+// counted as cancelled
+func processFiles(ctx context.Context, files []string, opts options, reporters ...reporter) results {
+	var (
+		wg     sync.WaitGroup
+		budget = newMemBudget(opts.maxMem)
+		counts tally
+	)
+	// Each worker writes only the entries of the files it takes
+	entries := make([]manifestEntry, len(files))
+	finish := func(entry *manifestEntry, err error, size int64) {
+		counts.done(*entry, err, size)
+		for _, r := range reporters {
+			r.done(*entry, err, size)
+		}
+	}
+
+	tasks := make(chan int, len(files))
+	for i := range files {
+		tasks <- i
 	}
 	close(tasks)
 
-	for i := 0; i < concurrency; i++ {
+	for i := 0; i < opts.concurrency; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for file := range tasks {
-				relPath, err := filepath.Rel(srcDir, file)
-				if err != nil {
-					relPath = file
+			for i := range tasks {
+				file := files[i]
+				dstPath := destPath(file, opts)
+				entry := &entries[i]
+				*entry = manifestEntry{Source: file, Dest: dstPath}
+
+				if ctx.Err() != nil {
+					entry.Status = statusCancelled
+					finish(entry, nil, 0)
+					continue
 				}
-				dstPath := filepath.Join(dstDir, strings.TrimSuffix(relPath, filepath.Ext(relPath))+".ntsm")
 
-				if verbose {
-					fmt.Printf("[worker] Converting %s → %s\n", relPath, dstPath)
+				if opts.incremental && upToDate(file, dstPath) {
+					entry.Status = statusSkipped
+					entry.fillStats()
+					finish(entry, nil, 0)
+					continue
 				}
 
-				if err := convertToNTSM(file, dstPath, dryRun, verbose); err != nil {
-					counter.Lock()
-					counter.failed++
-					counter.Unlock()
-					if verbose {
-						fmt.Printf("Failed: %v\n", err)
+				if opts.noClobber {
+					if _, err := os.Lstat(dstPath); err == nil {
+						entry.Status = statusExists
+						finish(entry, nil, 0)
+						continue
 					}
-				} else {
-					counter.Lock()
-					counter.success++
-					counter.Unlock()
-					if verbose {
-						fmt.Printf("Converted: %s\n", relPath)
+				}
+
+				cost, err := budget.acquire(ctx, estimateCost(file, opts), func() {
+					if opts.verbose {
+						fmt.Printf("Waiting for memory budget: %s\n", relPath(file, opts))
 					}
+				})
+				if errors.Is(err, errOverBudget) {
+					entry.Status, entry.Error = statusFailed, err.Error()
+					finish(entry, err, 0)
+					continue
+				}
+				if err != nil {
+					entry.Status = statusCancelled
+					finish(entry, nil, 0)
+					continue
+				}
+
+				if opts.verbose {
+					fmt.Printf("[worker] Converting %s → %s\n", relPath(file, opts), dstPath)
+				}
+
+				var size int64
+				if opts.dryRunFast {
+					size, err = estimateOutputSize(file)
+				} else {
+					size, err = convertWithTimeout(ctx, file, dstPath, opts)
+				}
+				budget.release(cost)
+				switch {
+				case errors.Is(err, errClobber):
+					// Created by another worker since the check above
+					entry.Status = statusExists
+					finish(entry, nil, 0)
+				case errors.Is(err, context.Canceled):
+					entry.Status = statusCancelled
+					finish(entry, err, 0)
+				case err != nil:
+					entry.Status, entry.Error = statusFailed, err.Error()
+					finish(entry, err, 0)
+				case opts.dryRun:
+					entry.Status, entry.Bytes = statusDryRun, size
+					finish(entry, nil, size)
+				default:
+					entry.Status = statusConverted
+					entry.fillStats()
+					finish(entry, nil, size)
 				}
 			}
 		}()
 	}
 
 	wg.Wait()
-	return counter.success, counter.failed
+	counts.entries = entries
+	return counts.results
 }
 
-func convertToNTSM(srcPath, dstPath string, dryRun bool, verbose bool) error {
+// upToDate reports whether dstPath exists and is newer than the source, its
+// particle sidecar and, for OBJs, its material library
+func upToDate(srcPath, dstPath string) bool {
+	dst, err := os.Stat(dstPath)
+	if err != nil {
+		return false
+	}
+	src, err := os.Stat(srcPath)
+	if err != nil || !dst.ModTime().After(src.ModTime()) {
+		return false
+	}
+	if sidecar, err := os.Stat(sidecarPath(srcPath)); err == nil && !dst.ModTime().After(sidecar.ModTime()) {
+		return false
+	}
+	if strings.EqualFold(filepath.Ext(srcPath), ".obj") {
+		if mtl, err := os.Stat(mtlPath(srcPath)); err == nil && !dst.ModTime().After(mtl.ModTime()) {
+			return false
+		}
+	}
+	return true
+}
+
+// convert converts one file; tests replace it
+var convert = convertToNTSM
+
+// convertWithTimeout runs convert under the -timeout deadline, if any,
+// failing a conversion that overruns it with errTimeout
+func convertWithTimeout(ctx context.Context, srcPath, dstPath string, opts options) (int64, error) {
+	if opts.timeout <= 0 {
+		return convert(ctx, srcPath, dstPath, opts)
+	}
+	tctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+
+	size, err := convert(tctx, srcPath, dstPath, opts)
+	if err != nil && ctx.Err() == nil && errors.Is(tctx.Err(), context.DeadlineExceeded) {
+		return 0, fmt.Errorf("%w after %v: %s", errTimeout, opts.timeout, srcPath)
+	}
+	return size, err
+}
+
+// convertToNTSM writes srcPath to dstPath as NTSM and returns its size. In
+// a dry run nothing is written and the size is what would have been
+func convertToNTSM(ctx context.Context, srcPath, dstPath string, opts options) (int64, error) {
+	name := itemName(srcPath, opts)
+	attribution := attributionFor(name, opts)
+
 	var glbData []byte
+	var src *os.File // GLB passed through unbuffered, when set
 	var err error
 
-	if strings.HasSuffix(srcPath, ".obj") {
-		if verbose {
+	switch strings.ToLower(filepath.Ext(srcPath)) {
+	case ".obj":
+		if opts.verbose {
 			fmt.Printf("[worker] Converting .obj to GLB: %s\n", srcPath)
 		}
 
 		tempGLBPath := srcPath + ".temp.glb"
 
-		cmd := exec.Command("obj2gltf", "-b", "-i", srcPath, "-o", tempGLBPath)
-		if verbose {
+		cmd := exec.CommandContext(ctx, "obj2gltf", "-b", "-i", srcPath, "-o", tempGLBPath)
+		if opts.verbose {
 			cmd.Stdout = os.Stdout
 			cmd.Stderr = os.Stderr
 		}
 
 		if err = cmd.Run(); err != nil {
-			return fmt.Errorf("[worker] obj2gltf conversion failed: %w", err)
+			if ctx.Err() != nil {
+				os.Remove(tempGLBPath)
+				return 0, fmt.Errorf("[worker] obj2gltf conversion interrupted: %w", ctx.Err())
+			}
+			return 0, fmt.Errorf("[worker] obj2gltf conversion failed: %w", err)
 		}
 
 		glbData, err = os.ReadFile(tempGLBPath)
 		if err != nil {
-			return fmt.Errorf("[worker] failed to read converted GLB: %w", err)
+			return 0, fmt.Errorf("[worker] failed to read converted GLB: %w", err)
 		}
 
 		if len(glbData) < 4 || string(glbData[0:4]) != "glTF" {
-			return fmt.Errorf("[worker] converted file is not a valid GLB file")
+			return 0, fmt.Errorf("[worker] converted file is not a valid GLB file")
 		}
 
-		if !dryRun && !verbose {
+		if !opts.verbose {
 			os.Remove(tempGLBPath)
 		}
-	} else {
+	case ".gltf":
+		glbData, err = gltfToGLB(srcPath)
+		if err != nil {
+			return 0, fmt.Errorf("[worker] glTF conversion failed: %w", err)
+		}
+	default:
+		if !opts.compress && !opts.thumbnail && attribution == "" {
+			// Stream the GLB straight through instead of buffering it
+			if src, err = openGLB(srcPath); err != nil {
+				return 0, fmt.Errorf("[worker] read failed: %w", err)
+			}
+			defer src.Close()
+			break
+		}
 		glbData, err = os.ReadFile(srcPath)
 		if err != nil {
-			return fmt.Errorf("[worker] read failed: %w", err)
+			return 0, fmt.Errorf("[worker] read failed: %w", err)
+		}
+		if len(glbData) < 4 || string(glbData[0:4]) != "glTF" {
+			return 0, fmt.Errorf("[worker] %s is not a valid GLB file", srcPath)
 		}
 	}
 
-	header := createHeader(srcPath, glbData)
+	header, truncated := createHeader(name)
+	if truncated {
+		fmt.Fprintf(os.Stderr, "[worker] Warning: name for %s truncated to %d bytes\n", srcPath, len(header.NameString()))
+	}
 
-	if dryRun {
-		return nil
+	emitters, err := loadParticleSidecar(srcPath)
+	if err != nil {
+		return 0, err
+	}
+	if opts.verbose && len(emitters) > 0 {
+		fmt.Printf("[worker] Embedding %d particle emitters from %s\n", len(emitters), sidecarPath(srcPath))
+	}
+
+	var textures []ntsm.Texture
+	if strings.EqualFold(filepath.Ext(srcPath), ".obj") {
+		if textures, err = applyMaterials(srcPath, emitters); err != nil {
+			return 0, err
+		}
+		if opts.verbose && len(textures) > 0 {
+			fmt.Printf("[worker] Embedding %d textures from %s\n", len(textures), mtlPath(srcPath))
+		}
+	}
+
+	encOpts := ntsm.EncodeOptions{Textures: opts.textures}
+	if opts.compress {
+		encOpts.Compression = ntsm.CompressionDeflate
+	}
+	if attribution != "" {
+		encOpts.Meta = map[string]string{ntsm.MetaAttribution: attribution}
+	}
+	if opts.thumbnail {
+		if encOpts.Thumbnail, err = renderThumbnailContext(ctx, glbData); err != nil {
+			return 0, fmt.Errorf("[worker] thumbnail render failed: %w", err)
+		}
+	}
+
+	if opts.dryRun {
+		if src != nil {
+			// A streamed GLB is copied verbatim, so there's nothing to encode
+			info, err := src.Stat()
+			if err != nil {
+				return 0, fmt.Errorf("[worker] stat failed: %w", err)
+			}
+			return ntsm.HeaderSize + info.Size() + int64(ntsm.EncodedParticleSize(emitters)), nil
+		}
+		var n byteCounter
+		if err := ntsm.EncodeContext(ctx, &n, &header, glbData, emitters, textures, encOpts); err != nil {
+			return 0, fmt.Errorf("[worker] encode failed: %w", err)
+		}
+		return int64(n), nil
 	}
 
 	if err = os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
-		return fmt.Errorf("[worker] mkdir failed: %w", err)
+		return 0, fmt.Errorf("[worker] mkdir failed: %w", err)
 	}
 
-	out, err := os.Create(dstPath)
+	// Write to a temp file beside the destination and rename it into place,
+	// so a failed conversion never leaves a truncated .ntsm behind
+	out, err := os.CreateTemp(filepath.Dir(dstPath), "."+filepath.Base(dstPath)+".*.tmp")
 	if err != nil {
-		return fmt.Errorf("[worker] create failed: %w", err)
+		return 0, fmt.Errorf("[worker] create failed: %w", err)
 	}
+	defer os.Remove(out.Name()) // No-op once renamed; drops the extra name once linked
 	defer out.Close()
 
-	if err = binary.Write(out, binary.LittleEndian, header); err != nil {
-		return fmt.Errorf("[worker] header write failed: %w", err)
+	if src != nil {
+		err = ntsm.EncodeStream(out, &header, ntsm.ContextReader(ctx, src), emitters)
+	} else {
+		err = ntsm.EncodeContext(ctx, out, &header, glbData, emitters, textures, encOpts)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("[worker] write failed: %w", err)
+	}
+	if err = out.Chmod(0644); err != nil {
+		return 0, fmt.Errorf("[worker] chmod failed: %w", err)
+	}
+	if err = out.Close(); err != nil {
+		return 0, fmt.Errorf("[worker] write failed: %w", err)
+	}
+	if err = moveIntoPlace(out.Name(), dstPath, opts.noClobber); err != nil {
+		return 0, err
 	}
 
-	if _, err = out.Write(glbData); err != nil {
-		return fmt.Errorf("[worker] glb write failed: %w", err)
+	if opts.verbose && header.IsCompressed() && len(glbData) > 0 {
+		fmt.Printf("[worker] GLB compressed %d → %d bytes (%.1f%%)\n",
+			len(glbData), header.GLBSize, 100*float64(header.GLBSize)/float64(len(glbData)))
+	}
+	info, err := os.Stat(dstPath)
+	if err != nil {
+		return 0, fmt.Errorf("[worker] stat failed: %w", err)
+	}
+	if opts.verbose {
+		fmt.Printf("[worker] Wrote %s: %v\n", dstPath, header.Stats(info.Size()))
 	}
 
+	return info.Size(), nil
+}
+
+// moveIntoPlace renames the finished temp file to dstPath. With noClobber it
+// hard-links instead, which fails atomically if dstPath exists, falling back
+// to a rename on filesystems without hard links
+func moveIntoPlace(tmpPath, dstPath string, noClobber bool) error {
+	if noClobber {
+		err := os.Link(tmpPath, dstPath)
+		if errors.Is(err, fs.ErrExist) {
+			return errClobber
+		}
+		if err == nil {
+			return nil // The deferred remove cleans up tmpPath
+		}
+	}
+	if err := os.Rename(tmpPath, dstPath); err != nil {
+		return fmt.Errorf("[worker] rename failed: %w", err)
+	}
 	return nil
 }
 
-func createHeader(srcPath string, glbData []byte) NTSMHeader {
-	base := filepath.Base(srcPath)
-	itemID := strings.TrimSuffix(base, filepath.Ext(base))
+// openGLB opens a GLB file, checking its magic
+func openGLB(srcPath string) (*os.File, error) {
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil || string(magic) != "glTF" {
+		f.Close()
+		return nil, fmt.Errorf("%s is not a valid GLB file", srcPath)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// sidecarPath returns the particle sidecar for srcPath, e.g.
+// sword.obj → sword.particles.json
+func sidecarPath(srcPath string) string {
+	return strings.TrimSuffix(srcPath, filepath.Ext(srcPath)) + ".particles.json"
+}
+
+// loadParticleSidecar reads the emitters declared next to srcPath, returning
+// nil when there is no sidecar
+func loadParticleSidecar(srcPath string) ([]ntsm.ParticleEmitter, error) {
+	f, err := os.Open(sidecarPath(srcPath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[worker] open particle sidecar failed: %w", err)
+	}
+	defer f.Close()
+
+	emitters, err := ntsm.ReadEmittersJSON(f)
+	if err != nil {
+		return nil, fmt.Errorf("[worker] particle sidecar %s: %w", f.Name(), err)
+	}
+	return emitters, nil
+}
+
+// itemName returns the name to embed for srcPath: -name in single-file mode,
+// otherwise -name-template expanded against the path relative to -src
+func itemName(srcPath string, opts options) string {
+	if opts.singleFile {
+		if opts.name != "" {
+			return opts.name
+		}
+		stem, _ := splitExt(filepath.Base(srcPath))
+		return stem
+	}
 
-	header := NTSMHeader{
-		Version:        1,
-		GLBOffset:      HeaderSize,
-		GLBSize:        uint32(len(glbData)),
-		ParticleOffset: HeaderSize + uint32(len(glbData)),
-		ParticleSize:   0,
-		TextureCount:   0,
-		TextureOffset:  0,
-		Flags:          0,
+	rel, err := filepath.Rel(opts.srcDir, srcPath)
+	if err != nil {
+		rel = filepath.Base(srcPath)
 	}
+	return expandNameTemplate(opts.template, filepath.ToSlash(rel))
+}
 
-	copy(header.Magic[:], []byte("NTSM"))
+// expandNameTemplate expands {dir}, {stem} and {ext} for the slash-separated
+// relative path rel. Top-level files have an empty {dir}, and the separators
+// next to it are dropped with it, so "{dir}/{stem}" and "{dir}-{stem}" give
+// "sword" for sword.obj and "weapons/sword" or "weapons-sword" for
+// weapons/sword.obj
+func expandNameTemplate(tmpl, rel string) string {
+	dir, base := path.Split(rel)
+	if dir == "" {
+		tmpl = dropField(tmpl, "{dir}")
+	}
+	stem, ext := splitExt(base)
+	name := strings.NewReplacer(
+		"{dir}", strings.TrimSuffix(dir, "/"),
+		"{stem}", stem,
+		"{ext}", strings.TrimPrefix(ext, "."),
+	).Replace(tmpl)
+	return strings.Trim(name, "/")
+}
 
-	name := []byte(itemID)
-	if len(name) > 127 {
-		name = name[:127]
+// nameSeparators are the characters dropField treats as joining a field to
+// its neighbours
+const nameSeparators = "/-_. "
+
+// dropField removes each field from tmpl with the separators that follow
+// it or, for a field with none after it, the ones before it
+func dropField(tmpl, field string) string {
+	for {
+		before, after, found := strings.Cut(tmpl, field)
+		if !found {
+			return tmpl
+		}
+		if trimmed := strings.TrimLeft(after, nameSeparators); trimmed != after {
+			after = trimmed
+		} else {
+			before = strings.TrimRight(before, nameSeparators)
+		}
+		tmpl = before + after
 	}
-	copy(header.Name[:], name)
+}
 
-	return header
+// createHeader builds the header for an item; offsets and sizes are filled
+// in by ntsm.Encode. It reports whether name had to be truncated to fit
+func createHeader(name string) (ntsm.Header, bool) {
+	var header ntsm.Header
+	header.SetName(name)
+	return header, header.NameString() != name
 }
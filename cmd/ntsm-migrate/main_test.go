@@ -0,0 +1,686 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/netisu/ntsm"
+	"github.com/qmuntal/gltf"
+)
+
+func TestSplitExt(t *testing.T) {
+	for _, tt := range []struct{ base, stem, ext string }{
+		{"sword.obj", "sword", ".obj"},
+		{"teapot.v2.obj", "teapot.v2", ".obj"},
+		{"archive.tar.glb", "archive.tar", ".glb"},
+		{"Sword.OBJ", "Sword", ".OBJ"},
+		{".obj", ".obj", ""},
+		{"..glb", ".", ".glb"},
+		{"noext", "noext", ""},
+		{"trailing.", "trailing", "."},
+	} {
+		stem, ext := splitExt(tt.base)
+		if stem != tt.stem || ext != tt.ext {
+			t.Errorf("splitExt(%q) = %q, %q, want %q, %q", tt.base, stem, ext, tt.stem, tt.ext)
+		}
+	}
+}
+
+func TestIsSourceFile(t *testing.T) {
+	exts := []string{".obj", ".glb", ".gltf"}
+	for _, tt := range []struct {
+		path string
+		want bool
+	}{
+		{"sword.obj", true},
+		{"teapot.v2.GLB", true},
+		{filepath.Join("a.obj", "notes.txt"), false},
+		{filepath.Join("models", ".obj"), false},
+		{"sword.obj.bak", false},
+	} {
+		if got := isSourceFile(tt.path, exts); got != tt.want {
+			t.Errorf("isSourceFile(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFindSourceFilesFilters(t *testing.T) {
+	src := t.TempDir()
+	for _, name := range []string{"hat.glb", "hats/red.obj", "hats/wip/blue.obj", "swords/long.glb", "notes.txt"} {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		name             string
+		include, exclude patternList
+		want             []string
+		stats            filterStats
+	}{
+		{"no filters", nil, nil, []string{"hat.glb", "hats/red.obj", "hats/wip/blue.obj", "swords/long.glb"}, filterStats{}},
+		{"include by name", patternList{"*.obj"}, nil, []string{"hats/red.obj", "hats/wip/blue.obj"}, filterStats{notIncluded: 2}},
+		{"include by path", patternList{"hats/*"}, nil, []string{"hats/red.obj"}, filterStats{notIncluded: 3}},
+		{"exclude by name", nil, patternList{"blue.*"}, []string{"hat.glb", "hats/red.obj", "swords/long.glb"}, filterStats{excluded: 1}},
+		// A file matching both is excluded, and counted only as excluded
+		{"exclude wins", patternList{"*.obj"}, patternList{"hats/wip/*"}, []string{"hats/red.obj"}, filterStats{notIncluded: 2, excluded: 1}},
+		{"exclude wins by name", patternList{"red.obj"}, patternList{"red.obj"}, nil, filterStats{notIncluded: 3, excluded: 1}},
+		{"any include matches", patternList{"hat.glb", "swords/*"}, nil, []string{"hat.glb", "swords/long.glb"}, filterStats{notIncluded: 2}},
+	} {
+		files, stats, err := findSourceFiles(options{srcDir: src, exts: []string{".obj", ".glb"}, include: tt.include, exclude: tt.exclude})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, f := range files {
+			rel, _ := filepath.Rel(src, f)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		if !slices.Equal(got, tt.want) || stats != tt.stats {
+			t.Errorf("%s: files %q, stats %+v; want %q, %+v", tt.name, got, stats, tt.want, tt.stats)
+		}
+	}
+}
+
+func TestDestPath(t *testing.T) {
+	src := filepath.Join("uploads", "items")
+	dst := filepath.Join("out", "items")
+	for _, tt := range []struct {
+		file string
+		opts options
+		want string
+	}{
+		{filepath.Join(src, "sword.obj"), options{srcDir: src, dstDir: dst}, filepath.Join(dst, "sword.ntsm")},
+		{filepath.Join(src, "teapot.v2.obj"), options{srcDir: src, dstDir: dst}, filepath.Join(dst, "teapot.v2.ntsm")},
+		{filepath.Join(src, "v1.5", "archive.tar.glb"), options{srcDir: src, dstDir: dst}, filepath.Join(dst, "v1.5", "archive.tar.ntsm")},
+		{filepath.Join(src, "sword.obj"), options{srcDir: src + string(filepath.Separator), dstDir: dst + string(filepath.Separator)}, filepath.Join(dst, "sword.ntsm")},
+
+		// Single-file mode
+		{"teapot.v2.obj", options{singleFile: true, dstDir: "teapot.ntsm"}, "teapot.ntsm"},
+		{"teapot.v2.obj", options{singleFile: true, dstDir: "Teapot.NTSM"}, "Teapot.NTSM"},
+		{"teapot.v2.obj", options{singleFile: true, dstDir: dst}, filepath.Join(dst, "teapot.v2.ntsm")},
+		{"teapot.v2.obj", options{singleFile: true, dstDir: "models.ntsm" + string(filepath.Separator)}, filepath.Join("models.ntsm", "teapot.v2.ntsm")},
+	} {
+		if got := destPath(tt.file, tt.opts); got != tt.want {
+			t.Errorf("destPath(%q, %+v) = %q, want %q", tt.file, tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestItemName(t *testing.T) {
+	src := filepath.Join("uploads", "items")
+	for _, tt := range []struct {
+		file, template string
+		want           string
+	}{
+		{filepath.Join(src, "sword.obj"), "{stem}", "sword"},
+		{filepath.Join(src, "teapot.v2.obj"), "{stem}", "teapot.v2"},
+		{filepath.Join(src, "archive.tar.glb"), "{stem}.{ext}", "archive.tar.glb"},
+		{filepath.Join(src, "weapons", "sword.v2.obj"), "{dir}/{stem}", "weapons/sword.v2"},
+		{filepath.Join(src, "v1.5", "hat.obj"), "{dir}-{stem}", "v1.5-hat"},
+		{filepath.Join(src, "sword.obj"), "{dir}/{stem}", "sword"},
+		{filepath.Join(src, "sword.obj"), "{dir}-{stem}", "sword"},
+		{filepath.Join(src, "sword.obj"), "{stem}_{dir}", "sword"},
+		{filepath.Join(src, "sword.obj"), "item-{dir}-{stem}", "item-sword"},
+		{filepath.Join(src, ".obj"), "{stem}", ".obj"},
+	} {
+		opts := options{srcDir: src, template: tt.template}
+		if got := itemName(tt.file, opts); got != tt.want {
+			t.Errorf("itemName(%q, %q) = %q, want %q", tt.file, tt.template, got, tt.want)
+		}
+	}
+
+	single := options{singleFile: true}
+	if got := itemName(filepath.Join("models", "teapot.v2.obj"), single); got != "teapot.v2" {
+		t.Errorf("single-file itemName = %q, want teapot.v2", got)
+	}
+	single.name = "Teapot"
+	if got := itemName("teapot.v2.obj", single); got != "Teapot" {
+		t.Errorf("single-file itemName with -name = %q, want Teapot", got)
+	}
+}
+
+func TestCreateHeader(t *testing.T) {
+	if h, truncated := createHeader("剣 sword"); truncated || h.NameString() != "剣 sword" {
+		t.Errorf("createHeader(short) = %q, truncated %v", h.NameString(), truncated)
+	}
+	long := strings.Repeat("ab", 63) + "日本"
+	h, truncated := createHeader(long)
+	if !truncated || h.NameString() != strings.Repeat("ab", 63) {
+		t.Errorf("createHeader(%d bytes) = %q, truncated %v", len(long), h.NameString(), truncated)
+	}
+}
+
+func TestMoveIntoPlaceNoClobber(t *testing.T) {
+	dir := t.TempDir()
+	tmp := filepath.Join(dir, "out.tmp")
+	dst := filepath.Join(dir, "out.ntsm")
+	if err := os.WriteFile(tmp, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := moveIntoPlace(tmp, dst, true); !errors.Is(err, errClobber) {
+		t.Fatalf("moveIntoPlace over an existing file = %v, want errClobber", err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "old" {
+		t.Errorf("destination overwritten with %q", data)
+	}
+
+	if err := moveIntoPlace(tmp, dst, false); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "new" {
+		t.Errorf("destination = %q after overwrite", data)
+	}
+}
+
+func TestFlattenPaths(t *testing.T) {
+	src := filepath.Join("uploads", "items")
+	dst := filepath.Join("out", "items")
+	files := []string{
+		filepath.Join(src, "hat.obj"),
+		filepath.Join(src, "weapons", "sword.obj"),
+		filepath.Join(src, "old", "sword.glb"),
+		filepath.Join(src, "sword-2.obj"),
+		filepath.Join(src, "v1", "Sword.gltf"),
+	}
+	opts := options{srcDir: src, dstDir: dst, flatten: true}
+	flat, collisions := flattenPaths(files, opts)
+	opts.flat = flat
+
+	want := []string{"hat.ntsm", "sword.ntsm", "sword-3.ntsm", "sword-2.ntsm", "Sword-4.ntsm"}
+	for i, file := range files {
+		if got := destPath(file, opts); got != filepath.Join(dst, want[i]) {
+			t.Errorf("destPath(%q) = %q, want %q", file, got, filepath.Join(dst, want[i]))
+		}
+	}
+
+	if len(collisions) != 2 {
+		t.Fatalf("got %d collisions, want 2: %+v", len(collisions), collisions)
+	}
+	first := collision{file: files[2], with: files[1], want: "sword.ntsm", dst: filepath.Join(dst, "sword-3.ntsm")}
+	if collisions[0] != first {
+		t.Errorf("collisions[0] = %+v, want %+v", collisions[0], first)
+	}
+	if c := collisions[1]; c.file != files[4] || c.with != files[1] || c.want != "Sword.ntsm" {
+		t.Errorf("collisions[1] = %+v, want %s colliding with %s", c, files[4], files[1])
+	}
+}
+
+// TestTimeout runs a batch where one conversion hangs until its context is
+// done: it fails as timed out while the rest of the batch converts
+func TestTimeout(t *testing.T) {
+	defer func(c func(context.Context, string, string, options) (int64, error)) { convert = c }(convert)
+	convert = func(ctx context.Context, src, dst string, opts options) (int64, error) {
+		if strings.Contains(src, "slow") {
+			<-ctx.Done()
+			return 0, ctx.Err()
+		}
+		return 1, nil
+	}
+
+	src := t.TempDir()
+	files := []string{filepath.Join(src, "fast.glb"), filepath.Join(src, "slow.obj"), filepath.Join(src, "fast2.glb")}
+	opts := options{srcDir: src, dstDir: t.TempDir(), concurrency: 1, timeout: 20 * time.Millisecond}
+	r := processFiles(context.Background(), files, opts)
+
+	if r.success != 2 || r.failed != 1 || r.timedOut != 1 {
+		t.Errorf("got %d converted, %d failed, %d timed out; want 2, 1, 1", r.success, r.failed, r.timedOut)
+	}
+	if e := r.entries[1]; e.Status != statusFailed || !strings.Contains(e.Error, "timed out") {
+		t.Errorf("slow entry = %+v, want failed as timed out", e)
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	defer func(c func(context.Context, string, string, options) (int64, error)) { convert = c }(convert)
+	convert = func(ctx context.Context, src, dst string, opts options) (int64, error) {
+		return 1, nil
+	}
+
+	old, now := time.Now().Add(-time.Hour), time.Now()
+	tests := []struct {
+		name     string
+		dstTime  time.Time // Zero for no output
+		dryRun   bool
+		upToDate bool
+		status   string
+		skipped  int
+	}{
+		{name: "up to date", dstTime: now, upToDate: true, status: statusSkipped, skipped: 1},
+		{name: "stale", dstTime: old.Add(-time.Minute), status: statusConverted},
+		{name: "missing output", status: statusConverted},
+		{name: "dry run up to date", dstTime: now, dryRun: true, upToDate: true, status: statusSkipped, skipped: 1},
+		{name: "dry run stale", dstTime: old.Add(-time.Minute), dryRun: true, status: statusDryRun},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := options{srcDir: t.TempDir(), dstDir: t.TempDir(), concurrency: 1, incremental: true, dryRun: tt.dryRun}
+			file := filepath.Join(opts.srcDir, "sword.glb")
+			if err := os.WriteFile(file, nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(file, old, old); err != nil {
+				t.Fatal(err)
+			}
+			dst := destPath(file, opts)
+			if !tt.dstTime.IsZero() {
+				if err := os.WriteFile(dst, nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(dst, tt.dstTime, tt.dstTime); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := upToDate(file, dst); got != tt.upToDate {
+				t.Errorf("upToDate = %v, want %v", got, tt.upToDate)
+			}
+			r := processFiles(context.Background(), []string{file}, opts)
+			if got := r.entries[0].Status; got != tt.status {
+				t.Errorf("status = %q, want %q", got, tt.status)
+			}
+			if r.skipped != tt.skipped {
+				t.Errorf("skipped = %d, want %d", r.skipped, tt.skipped)
+			}
+		})
+	}
+}
+
+func TestAttribution(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	glb, err := os.ReadFile("test.glb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"hat.glb", "sword.glb"} {
+		if err := os.WriteFile(filepath.Join(src, name), glb, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := filepath.Join(t.TempDir(), "attributions.json")
+	if err := os.WriteFile(file, []byte(`{"sword": "Sword by Ana, CC BY 4.0"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	attributions, err := loadAttributions(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := options{srcDir: src, dstDir: dst, template: "{stem}", attribution: "netisu", attributions: attributions}
+
+	for stem, want := range map[string]string{"hat": "netisu", "sword": "Sword by Ana, CC BY 4.0"} {
+		out := filepath.Join(dst, stem+".ntsm")
+		if _, err := convertToNTSM(context.Background(), filepath.Join(src, stem+".glb"), out, opts); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		meta, err := ntsm.ReadMeta(f)
+		f.Close()
+		if err != nil || meta[ntsm.MetaAttribution] != want {
+			t.Errorf("%s: metadata %v, %v; want attribution %q", stem, meta, err, want)
+		}
+	}
+}
+
+// TestConvertDecodes converts a GLB the way the tool does, streamed and
+// compressed, and checks the library reads back the same GLB
+func TestConvertDecodes(t *testing.T) {
+	glb, err := os.ReadFile("test.glb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, dst := t.TempDir(), t.TempDir()
+	in := filepath.Join(src, "hat.glb")
+	if err := os.WriteFile(in, glb, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, compress := range []bool{false, true} {
+		out := filepath.Join(dst, "hat.ntsm")
+		opts := options{srcDir: src, dstDir: dst, template: "{stem}", compress: compress}
+		size, err := convertToNTSM(context.Background(), in, out, opts)
+		if err != nil {
+			t.Fatalf("compress %v: %v", compress, err)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != int64(len(data)) {
+			t.Errorf("compress %v: reported size %d, file is %d bytes", compress, size, len(data))
+		}
+		if err := ntsm.Verify(bytes.NewReader(data), int64(len(data))); err != nil {
+			t.Errorf("compress %v: Verify: %v", compress, err)
+		}
+
+		var c ntsm.Container
+		if _, err := c.ReadFrom(bytes.NewReader(data)); err != nil {
+			t.Fatalf("compress %v: ReadFrom: %v", compress, err)
+		}
+		if !bytes.Equal(c.GLB, glb) {
+			t.Errorf("compress %v: decoded GLB differs from the source", compress)
+		}
+		if c.Header.IsCompressed() != compress || c.Header.NameString() != "hat" || c.Header.HasParticles() {
+			t.Errorf("compress %v: header %+v", compress, c.Header)
+		}
+		os.Remove(out)
+	}
+}
+
+// TestMemBudget holds part of a budget and checks that a job that doesn't
+// fit waits, says so, and starts once the budget is released
+func TestMemBudget(t *testing.T) {
+	b := newMemBudget(100)
+	held, err := b.acquire(context.Background(), 60, nil)
+	if err != nil || held != 60 {
+		t.Fatalf("acquire(60) = %d, %v", held, err)
+	}
+
+	waited := make(chan struct{})
+	acquired := make(chan int64)
+	go func() {
+		cost, err := b.acquire(context.Background(), 50, func() { close(waited) })
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- cost
+	}()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("acquire over the budget didn't wait")
+	}
+	select {
+	case <-acquired:
+		t.Fatal("acquire over the budget didn't block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	b.release(held)
+	select {
+	case cost := <-acquired:
+		if cost != 50 {
+			t.Errorf("acquired %d, want 50", cost)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("acquire didn't resume after release")
+	}
+
+	// A cancelled wait gives up
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := b.acquire(ctx, 60, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled acquire = %v, want context.Canceled", err)
+	}
+}
+
+// TestMaxMemTooLarge runs a batch where one file alone is estimated above
+// -max-mem: it fails without being converted, and the rest still run
+func TestMaxMemTooLarge(t *testing.T) {
+	src := t.TempDir()
+	files := []string{filepath.Join(src, "small.glb"), filepath.Join(src, "large.glb")}
+	if err := os.WriteFile(files[0], make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(files[1], make([]byte, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newMemBudget(500).acquire(context.Background(), 501, nil); !errors.Is(err, errOverBudget) {
+		t.Errorf("acquire above the limit = %v, want errOverBudget", err)
+	}
+
+	defer func(c func(context.Context, string, string, options) (int64, error)) { convert = c }(convert)
+	var mu sync.Mutex
+	var converted []string
+	convert = func(ctx context.Context, src, dst string, opts options) (int64, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		converted = append(converted, filepath.Base(src))
+		return 1, nil
+	}
+
+	// -compress buffers GLBs, giving them a cost of twice their size
+	opts := options{srcDir: src, dstDir: t.TempDir(), concurrency: 2, compress: true, maxMem: 500}
+	r := processFiles(context.Background(), files, opts)
+	if r.success != 1 || r.failed != 1 || !slices.Equal(converted, []string{"small.glb"}) {
+		t.Errorf("%d converted, %d failed, ran %q; want small.glb converted and large.glb failed", r.success, r.failed, converted)
+	}
+	if e := r.entries[1]; e.Status != statusFailed || !strings.Contains(e.Error, "-max-mem") {
+		t.Errorf("large.glb entry = %+v, want failed over -max-mem", e)
+	}
+}
+
+// TestParticleSidecar converts an OBJ and a GLB, each with a
+// .particles.json beside it, and one GLB without, and decodes the results.
+// obj2gltf is replaced by a script that writes test.glb
+func TestParticleSidecar(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the obj2gltf stand-in is a shell script")
+	}
+	glbPath, err := filepath.Abs("test.glb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := t.TempDir()
+	script := "#!/bin/sh\nwhile [ \"$1\" != -o ]; do shift; done\ncp '" + glbPath + "' \"$2\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "obj2gltf"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	const sidecar = `[
+		{"position": [0, 1, 0], "direction": [0, 1, 0], "emissionRate": 20, "particleLifetime": 1.5,
+		 "startSize": 0.2, "endSize": 0.05, "startColor": "#ff8000", "textureIndex": -1, "blendMode": "additive", "loop": "loop"},
+		{"emissionRate": 5, "particleLifetime": 3, "textureIndex": -1, "blendMode": "alpha", "loop": "once", "burstCount": 16}
+	]`
+	want, err := ntsm.ReadEmittersJSON(strings.NewReader(sidecar))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	glb, err := os.ReadFile(glbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, dst := t.TempDir(), t.TempDir()
+	for name, data := range map[string][]byte{
+		"torch.obj":            []byte("v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n"),
+		"torch.particles.json": []byte(sidecar),
+		"lamp.glb":             glb,
+		"lamp.particles.json":  []byte(sidecar),
+		"hat.glb":              glb,
+	} {
+		if err := os.WriteFile(filepath.Join(src, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := options{srcDir: src, dstDir: dst, template: "{stem}"}
+	for _, tt := range []struct {
+		src  string
+		want []ntsm.ParticleEmitter
+	}{
+		{"torch.obj", want},
+		{"lamp.glb", want},
+		{"hat.glb", nil},
+	} {
+		out := filepath.Join(dst, tt.src+".ntsm")
+		if _, err := convertToNTSM(context.Background(), filepath.Join(src, tt.src), out, opts); err != nil {
+			t.Fatalf("%s: %v", tt.src, err)
+		}
+		f, err := os.Open(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hdr, gotGLB, emitters, err := ntsm.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: Decode: %v", tt.src, err)
+		}
+		if !bytes.Equal(gotGLB, glb) {
+			t.Errorf("%s: decoded GLB differs from the converted one", tt.src)
+		}
+		if hdr.HasParticles() != (tt.want != nil) || hdr.ParticleSize != uint32(ntsm.EncodedParticleSize(tt.want)) {
+			t.Errorf("%s: particle flag %v, size %d; want %d emitters", tt.src, hdr.HasParticles(), hdr.ParticleSize, len(tt.want))
+		}
+		if !reflect.DeepEqual(emitters, tt.want) {
+			t.Errorf("%s: emitters = %+v, want %+v", tt.src, emitters, tt.want)
+		}
+	}
+}
+
+// recorder is a reporter that counts statuses
+type recorder struct {
+	mu       sync.Mutex
+	statuses map[string]int
+}
+
+func (r *recorder) done(e manifestEntry, err error, size int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statuses[e.Status]++
+}
+
+func TestReporter(t *testing.T) {
+	defer func(c func(context.Context, string, string, options) (int64, error)) { convert = c }(convert)
+	convert = func(ctx context.Context, src, dst string, opts options) (int64, error) {
+		if strings.Contains(src, "bad") {
+			return 0, errors.New("[worker] bad file")
+		}
+		return 10, nil
+	}
+
+	src := t.TempDir()
+	files := []string{filepath.Join(src, "a.glb"), filepath.Join(src, "bad.glb"), filepath.Join(src, "b.glb")}
+	rec := &recorder{statuses: map[string]int{}}
+	r := processFiles(context.Background(), files, options{srcDir: src, dstDir: t.TempDir(), concurrency: 2}, rec)
+	if rec.statuses[statusConverted] != 2 || rec.statuses[statusFailed] != 1 || len(rec.statuses) != 2 {
+		t.Errorf("reported %v, want 2 converted and 1 failed", rec.statuses)
+	}
+	if r.success != 2 || r.failed != 1 || r.bytes != 20 {
+		t.Errorf("results: %d converted, %d failed, %d bytes; want 2, 1, 20", r.success, r.failed, r.bytes)
+	}
+
+	// With a long interval only the first and last files print
+	var out strings.Builder
+	p := newProgressReporter(&out, 3, time.Hour)
+	p.done(manifestEntry{Status: statusConverted}, nil, 0)
+	p.done(manifestEntry{Status: statusFailed}, errors.New("bad"), 0)
+	p.done(manifestEntry{Status: statusSkipped}, nil, 0)
+	lines := strings.Split(strings.TrimPrefix(out.String(), "\r"), "\r")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "3/3 done, 1 failed, 0s elapsed, ETA 0s") || !strings.HasSuffix(out.String(), "\n") {
+		t.Errorf("progress output %q", out.String())
+	}
+	if got := shortDuration(125 * time.Second); got != "2m5s" {
+		t.Errorf("shortDuration(125s) = %q", got)
+	}
+	if got := shortDuration(2 * time.Minute); got != "2m" {
+		t.Errorf("shortDuration(2m) = %q", got)
+	}
+}
+
+func TestJSONLog(t *testing.T) {
+	var buf bytes.Buffer
+	l := newJSONLog(&buf)
+	opts := options{srcDir: "src", dstDir: "dst", concurrency: 2}
+	l.start([]string{"src/a.glb", "src/b.glb"}, opts)
+	l.done(manifestEntry{Source: "src/a.glb", Dest: "dst/a.ntsm", Status: statusConverted}, nil, 100)
+	l.done(manifestEntry{Source: "src/b.glb", Dest: "dst/b.ntsm", Status: statusFailed}, errors.New("[worker] bad"), 0)
+	l.summary(results{success: 1, failed: 1, bytes: 100}, time.Second, opts)
+
+	var events []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e map[string]any
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 4 {
+		t.Fatalf("got %d events, want 4", len(events))
+	}
+	for i, want := range []string{"start", "file", "file", "summary"} {
+		if events[i]["msg"] != want {
+			t.Errorf("event %d is %v, want %s", i, events[i]["msg"], want)
+		}
+	}
+	if e := events[2]; e["level"] != "ERROR" || e["error"] != "[worker] bad" || e["source"] != "src/b.glb" {
+		t.Errorf("failed file logged as %v", e)
+	}
+	if e := events[3]; e["converted"] != 1.0 || e["failed"] != 1.0 || e["seconds"] != 1.0 {
+		t.Errorf("summary logged as %v", e)
+	}
+}
+
+func TestGLTFToGLB(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "items")
+	png := []byte("\x89PNG texture")
+	for name, data := range map[string][]byte{
+		filepath.Join(dir, "sword.bin"):   {1, 2, 3, 4},
+		filepath.Join(dir, "sword.png"):   png,
+		filepath.Join(root, "secret.png"): []byte("\x89PNG not yours"),
+	} {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeGLTF := func(image string) string {
+		path := filepath.Join(dir, "sword.gltf")
+		doc := `{"asset":{"version":"2.0"},` +
+			`"buffers":[{"byteLength":4,"uri":"sword.bin"}],` +
+			`"bufferViews":[{"buffer":0,"byteLength":4}],` +
+			`"images":[{"uri":"` + image + `"}]}`
+		if err := os.WriteFile(path, []byte(doc), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	glb, err := gltfToGLB(writeGLTF("sword.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc gltf.Document
+	if err := gltf.NewDecoder(bytes.NewReader(glb)).Decode(&doc); err != nil {
+		t.Fatalf("decoding the packed GLB: %v", err)
+	}
+	img := doc.Images[0]
+	if img.URI != "" || img.BufferView == nil || img.MimeType != "image/png" {
+		t.Fatalf("image not embedded: %+v", img)
+	}
+	view := doc.BufferViews[*img.BufferView]
+	if got := doc.Buffers[0].Data[view.ByteOffset : view.ByteOffset+view.ByteLength]; !bytes.Equal(got, png) {
+		t.Errorf("embedded image = %q, want %q", got, png)
+	}
+
+	for _, uri := range []string{"../secret.png", "..%2Fsecret.png", "/etc/passwd.png"} {
+		if _, err := gltfToGLB(writeGLTF(uri)); err == nil {
+			t.Errorf("image URI %q outside the source directory was embedded", uri)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/netisu/ntsm"
+)
+
+// Manifest entry statuses
+const (
+	statusConverted = "converted"
+	statusFailed    = "failed"
+	statusSkipped   = "skipped"
+	statusCancelled = "cancelled"
+	statusDryRun    = "dry-run"
+	statusExists    = "exists" // Skipped by -no-clobber
+)
+
+// manifestEntry records the outcome of one file for -manifest
+type manifestEntry struct {
+	Source   string `json:"source"`
+	Dest     string `json:"dest"`
+	Bytes    int64  `json:"bytes"`
+	GLBBytes uint32 `json:"glbBytes"`
+	Emitters int    `json:"emitters"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// fillStats sets the sizes and emitter count from the header of the output
+// file, leaving them zero if it can't be read
+func (e *manifestEntry) fillStats() {
+	f, err := os.Open(e.Dest)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+	hdr, err := ntsm.DecodeHeader(f)
+	if err != nil {
+		return
+	}
+	stats := hdr.Stats(info.Size())
+	e.Bytes = stats.FileSize
+	e.GLBBytes = stats.GLBSize
+	e.Emitters = stats.EmitterCount
+}
+
+// writeManifest writes entries to path as an indented JSON array
+func writeManifest(path string, entries []manifestEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
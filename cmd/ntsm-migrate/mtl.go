@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/netisu/ntsm"
+)
+
+// mtlPath returns the material library of an OBJ: the first mtllib
+// statement, else the .mtl with the same stem. Libraries outside the OBJ's
+// directory are ignored, as its texture maps are
+func mtlPath(objPath string) string {
+	dir := filepath.Dir(objPath)
+	if f, err := os.Open(objPath); err == nil {
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			name, ok := strings.CutPrefix(strings.TrimSpace(sc.Text()), "mtllib ")
+			if name = strings.TrimSpace(name); ok && fs.ValidPath(name) {
+				return filepath.Join(dir, filepath.FromSlash(name))
+			}
+		}
+	}
+	return strings.TrimSuffix(objPath, filepath.Ext(objPath)) + ".mtl"
+}
+
+// applyMaterials embeds the diffuse maps of an OBJ's materials as textures
+// and seeds emitters that set neither color from the first material: its
+// diffuse color fading to transparent, and its map in place of the default
+// spark. An OBJ without a material library is left as is
+func applyMaterials(objPath string, emitters []ntsm.ParticleEmitter) ([]ntsm.Texture, error) {
+	path := mtlPath(objPath)
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[worker] open material library failed: %w", err)
+	}
+	defer f.Close()
+
+	materials, err := ntsm.ReadMTL(f)
+	if err != nil {
+		return nil, fmt.Errorf("[worker] material library %s: %w", path, err)
+	}
+	if len(materials) == 0 {
+		return nil, nil
+	}
+	textures, indices, err := ntsm.MaterialTextures(materials, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("[worker] material library %s: %w", path, err)
+	}
+
+	start := materials[0].Color()
+	end := start
+	end[3] = 0
+	for i := range emitters {
+		e := &emitters[i]
+		if e.StartColor != [4]float32{} || e.EndColor != [4]float32{} {
+			continue
+		}
+		e.StartColor, e.EndColor = start, end
+		if e.TextureIndex == -1 {
+			e.TextureIndex = indices[0]
+		}
+	}
+	return textures, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reporter is told the outcome of each file as processFiles finishes it.
+// done is called from the workers, so implementations must be safe for
+// concurrent use
+type reporter interface {
+	// done reports a file's manifest entry, its error if it failed or was
+	// cancelled mid-conversion, and its output size if it converted
+	done(e manifestEntry, err error, size int64)
+}
+
+// tally counts outcomes into results
+type tally struct {
+	mu sync.Mutex
+	results
+}
+
+func (t *tally) done(e manifestEntry, err error, size int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch e.Status {
+	case statusConverted, statusDryRun:
+		t.success++
+		t.bytes += size
+	case statusFailed:
+		t.failed++
+		if errors.Is(err, errTimeout) {
+			t.timedOut++
+		}
+	case statusSkipped:
+		t.skipped++
+	case statusExists:
+		t.clobbered++
+	case statusCancelled:
+		t.cancelled++
+	}
+}
+
+// progressReporter keeps a single line on w up to date with how far a
+// batch has got, rewriting it at most once per interval and always for the
+// last file
+type progressReporter struct {
+	mu       sync.Mutex
+	w        io.Writer
+	total    int
+	interval time.Duration
+	start    time.Time
+	last     time.Time // When the line was last written
+	width    int       // Length of the line last written, to blank leftovers
+	finished int
+	failed   int
+}
+
+func newProgressReporter(w io.Writer, total int, interval time.Duration) *progressReporter {
+	return &progressReporter{w: w, total: total, interval: interval, start: time.Now()}
+}
+
+func (p *progressReporter) done(e manifestEntry, err error, size int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.finished++
+	if e.Status == statusFailed {
+		p.failed++
+	}
+
+	now := time.Now()
+	if p.finished < p.total && now.Sub(p.last) < p.interval {
+		return
+	}
+	p.last = now
+
+	elapsed := now.Sub(p.start)
+	eta := elapsed / time.Duration(p.finished) * time.Duration(p.total-p.finished)
+	line := fmt.Sprintf("%d/%d done, %d failed, %s elapsed, ETA %s",
+		p.finished, p.total, p.failed, shortDuration(elapsed), shortDuration(eta))
+	pad := max(p.width-len(line), 0)
+	p.width = len(line)
+	fmt.Fprintf(p.w, "\r%s%s", line, strings.Repeat(" ", pad))
+	if p.finished == p.total {
+		fmt.Fprintln(p.w)
+	}
+}
+
+// shortDuration formats d to the second, dropping zero seconds after whole
+// minutes, e.g. "45s", "2m" or "1h3m20s"
+func shortDuration(d time.Duration) string {
+	s := d.Round(time.Second).String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	return s
+}
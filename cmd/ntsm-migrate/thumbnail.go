@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/netisu/aeno"
+)
+
+// thumbnailSize is the edge length of rendered thumbnails, in pixels
+const thumbnailSize = 128
+
+// renderThumbnailContext is renderThumbnail, abandoning the render once ctx
+// is done. aeno can't be interrupted, so the render finishes in the
+// background and its result is dropped
+func renderThumbnailContext(ctx context.Context, glbData []byte) ([]byte, error) {
+	type result struct {
+		png []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		png, err := renderThumbnail(glbData)
+		done <- result{png, err}
+	}()
+	select {
+	case r := <-done:
+		return r.png, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// renderThumbnail renders a PNG preview of the GLB, framed to fit
+func renderThumbnail(glbData []byte) ([]byte, error) {
+	mesh, err := aeno.LoadGLTFFromBytes(glbData)
+	if err != nil {
+		return nil, err
+	}
+	obj := &aeno.Object{
+		Mesh:   mesh,
+		Color:  aeno.White,
+		Matrix: aeno.Identity(),
+	}
+
+	var buf bytes.Buffer
+	err = aeno.GenerateSceneToWriter(&buf, []*aeno.Object{obj},
+		aeno.V(2, 1.5, 3), aeno.V(0, 0, 0), aeno.V(0, 1, 0), // eye, center, up
+		30, thumbnailSize, 2, // fovy, size, supersampling
+		aeno.V(0.5, 1, 1).Normalize(), "#404040", "#ffffff",
+		0.1, 100, true)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
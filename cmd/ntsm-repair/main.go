@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/netisu/ntsm"
+)
+
+func main() {
+	out := flag.String("o", "", "Write the repaired file here instead of replacing the input")
+	force := flag.Bool("force", false, "Rebuild the header even if the file verifies")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-o output] [-force] <file.ntsm>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+	if *out == "" {
+		*out = path
+	}
+
+	c, err := repairFile(path, *force)
+	if err != nil {
+		log.Fatalf("%s: %v", path, err)
+	}
+	if c == nil {
+		fmt.Printf("%s: nothing to repair\n", path)
+		return
+	}
+
+	if err := writeFile(*out, c); err != nil {
+		log.Fatalf("Writing %s: %v", *out, err)
+	}
+	_, hasThumb := c.Thumbnail()
+	fmt.Printf("%s: recovered GLB (%d bytes), %d emitters, %d textures, %d metadata keys, thumbnail: %v\n",
+		path, len(c.GLB), len(c.Emitters), len(c.Textures), len(c.Meta()), hasThumb)
+	if *out != path {
+		fmt.Printf("Wrote %s\n", *out)
+	}
+}
+
+// repairFile returns the repaired container, or nil if the file already
+// verifies and force is unset
+func repairFile(path string, force bool) (*ntsm.Container, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !force && ntsm.Verify(f, info.Size()) == nil {
+		return nil, nil
+	}
+	return ntsm.Repair(f, info.Size())
+}
+
+// writeFile writes c to a temp file beside path and renames it into place,
+// so a failed write never leaves the input half overwritten
+func writeFile(path string, c *ntsm.Container) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".ntsm-repair-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := c.WriteTo(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
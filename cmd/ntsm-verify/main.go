@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/netisu/ntsm"
+)
+
+func main() {
+	quiet := flag.Bool("q", false, "Only print files that fail")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-q] <file.ntsm|glob>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var paths []string
+	for _, arg := range flag.Args() {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			log.Fatalf("Invalid pattern: %v", err)
+		}
+		if len(matches) == 0 {
+			matches = []string{arg}
+		}
+		paths = append(paths, matches...)
+	}
+
+	failed := 0
+	for _, path := range paths {
+		err := verifyFile(path)
+		switch {
+		case err != nil && !onlyTrailing(err):
+			failed++
+			fmt.Printf("FAIL %s\n", path)
+			for _, e := range unjoin(err) {
+				fmt.Printf("  %v\n", e)
+			}
+		case err != nil:
+			// Trailing bytes alone are most likely a newer writer
+			fmt.Printf("warn %s\n  %v\n", path, err)
+		case !*quiet:
+			fmt.Printf("ok   %s\n", path)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("\n%d of %d files failed verification\n", failed, len(paths))
+		os.Exit(1)
+	}
+}
+
+func verifyFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return ntsm.Verify(f, info.Size())
+}
+
+// onlyTrailing reports whether every problem in err is trailing data
+func onlyTrailing(err error) bool {
+	for _, e := range unjoin(err) {
+		if !errors.Is(e, ntsm.ErrTrailingData) {
+			return false
+		}
+	}
+	return true
+}
+
+// unjoin splits an errors.Join result so each problem prints on its own line
+func unjoin(err error) []error {
+	var joined interface{ Unwrap() []error }
+	if errors.As(err, &joined) {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
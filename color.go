@@ -0,0 +1,74 @@
+package ntsm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseRGBA parses a hex color in #rgb, #rrggbb or #rrggbbaa form, with or
+// without the #, into RGBA components in [0, 1]. Alpha defaults to 1
+func ParseRGBA(hex string) ([4]float32, error) {
+	s := strings.TrimPrefix(hex, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) == 6 {
+		s += "ff"
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if len(s) != 8 || err != nil {
+		return [4]float32{}, fmt.Errorf("ntsm: bad hex color %q", hex)
+	}
+
+	var c [4]float32
+	for i := range c {
+		c[i] = float32(v>>(24-8*i)&0xff) / 255
+	}
+	return c, nil
+}
+
+// FormatRGBA formats c as #rrggbb, or #rrggbbaa when it isn't opaque.
+// Components are clamped to [0, 1] and rounded to 8 bits
+func FormatRGBA(c [4]float32) string {
+	var b [4]uint8
+	for i, f := range c {
+		b[i] = uint8(math.Round(float64(min(max(f, 0), 1)) * 255))
+	}
+	if b[3] == 0xff {
+		return fmt.Sprintf("#%02x%02x%02x", b[0], b[1], b[2])
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", b[0], b[1], b[2], b[3])
+}
+
+// StartColorHex returns StartColor formatted by FormatRGBA
+func (e ParticleEmitter) StartColorHex() string {
+	return FormatRGBA(e.StartColor)
+}
+
+// EndColorHex returns EndColor formatted by FormatRGBA
+func (e ParticleEmitter) EndColorHex() string {
+	return FormatRGBA(e.EndColor)
+}
+
+// colorJSON is an RGBA color that decodes from either a [r, g, b, a] array
+// or a hex string, and always encodes as an array so no precision is lost
+type colorJSON [4]float32
+
+func (c *colorJSON) UnmarshalJSON(data []byte) error {
+	if len(data) == 0 || data[0] != '"' {
+		return json.Unmarshal(data, (*[4]float32)(c))
+	}
+	var hex string
+	if err := json.Unmarshal(data, &hex); err != nil {
+		return err
+	}
+	rgba, err := ParseRGBA(hex)
+	if err != nil {
+		return err
+	}
+	*c = rgba
+	return nil
+}
@@ -0,0 +1,88 @@
+package ntsm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRGBA(t *testing.T) {
+	for _, tt := range []struct {
+		hex  string
+		want [4]float32
+	}{
+		{"#fff", [4]float32{1, 1, 1, 1}},
+		{"#f00", [4]float32{1, 0, 0, 1}},
+		{"#000000", [4]float32{0, 0, 0, 1}},
+		{"#ff8000", [4]float32{1, 128.0 / 255, 0, 1}},
+		{"#FF800080", [4]float32{1, 128.0 / 255, 0, 128.0 / 255}},
+		{"00ff0000", [4]float32{0, 1, 0, 0}},
+	} {
+		got, err := ParseRGBA(tt.hex)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseRGBA(%q) = %v, %v, want %v", tt.hex, got, err, tt.want)
+		}
+	}
+
+	for _, hex := range []string{"", "#", "#ff", "#ffff", "#fffff", "#fffffff", "#fffffffff", "#ggg", "#+fffff", "#ff ff ff"} {
+		if _, err := ParseRGBA(hex); err == nil {
+			t.Errorf("ParseRGBA(%q) succeeded", hex)
+		}
+	}
+}
+
+func TestFormatRGBA(t *testing.T) {
+	for _, tt := range []struct {
+		c    [4]float32
+		want string
+	}{
+		{[4]float32{1, 1, 1, 1}, "#ffffff"},
+		{[4]float32{1, 0.5, 0, 1}, "#ff8000"},
+		{[4]float32{1, 0, 0, 0}, "#ff000000"},
+		{[4]float32{2, -1, 0.2, 0.8}, "#ff0033cc"},
+	} {
+		if got := FormatRGBA(tt.c); got != tt.want {
+			t.Errorf("FormatRGBA(%v) = %q, want %q", tt.c, got, tt.want)
+		}
+	}
+
+	// Every 8-bit color survives a round trip
+	for _, hex := range []string{"#123456", "#abcdef10", "#000000", "#00000000"} {
+		c, err := ParseRGBA(hex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := FormatRGBA(c); got != hex {
+			t.Errorf("FormatRGBA(ParseRGBA(%q)) = %q", hex, got)
+		}
+	}
+
+	e := ParticleEmitter{StartColor: [4]float32{1, 1, 1, 1}, EndColor: [4]float32{1, 0, 0, 0}}
+	if e.StartColorHex() != "#ffffff" || e.EndColorHex() != "#ff000000" {
+		t.Errorf("hex colors = %q, %q", e.StartColorHex(), e.EndColorHex())
+	}
+}
+
+func TestEmitterJSONHexColors(t *testing.T) {
+	emitters, err := ReadEmittersJSON(strings.NewReader(`[
+		{"startColor": "#ff8000", "endColor": [1, 0, 0, 0]},
+		{"startColor": "#fff"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := emitters[0].StartColor; got != [4]float32{1, 128.0 / 255, 0, 1} {
+		t.Errorf("hex startColor = %v", got)
+	}
+	if got := emitters[0].EndColor; got != [4]float32{1, 0, 0, 0} {
+		t.Errorf("array endColor = %v", got)
+	}
+	if got := emitters[1].StartColor; got != [4]float32{1, 1, 1, 1} {
+		t.Errorf("short hex startColor = %v", got)
+	}
+
+	for _, color := range []string{`"white"`, `"#fff8"`} {
+		if _, err := ReadEmittersJSON(strings.NewReader(`[{"startColor": ` + color + `}]`)); err == nil {
+			t.Errorf("accepted startColor %s", color)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package ntsm
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Compression selects how the GLB region is stored
+type Compression int
+
+const (
+	CompressionNone    Compression = iota
+	CompressionDeflate             // DEFLATE (RFC 1951), sets FlagGLBCompressed
+)
+
+// compressGLB deflates the GLB payload
+func compressGLB(glbData []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(glbData); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressGLB inflates a compressed GLB region, refusing to produce more
+// than the uncompressed size recorded in the header
+func decompressGLB(data []byte, rawSize uint32) ([]byte, error) {
+	zr := flate.NewReader(bytes.NewReader(data))
+	defer zr.Close()
+
+	glbData, err := readSection(io.LimitReader(zr, int64(rawSize)+1), rawSize)
+	if err != nil {
+		return nil, fmt.Errorf("ntsm: decompressing GLB: %w", err)
+	}
+	if n, _ := zr.Read(make([]byte, 1)); n > 0 {
+		return nil, fmt.Errorf("ntsm: compressed GLB exceeds its declared size %d", rawSize)
+	}
+	return glbData, nil
+}
+
+// Magic numbers of whole-file compression formats, as found on .ntsm.gz and
+// .ntsm.zst files served by CDNs
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// DecodeAutoCompressed decodes an NTSM file that may be gzip-compressed as a
+// whole, as distinct from the GLB compression recorded in its header, so
+// foo.ntsm.gz loads like foo.ntsm. The format is sniffed from the first
+// bytes rather than a file name. Zstandard is recognized but, having no
+// decoder in the standard library, reported as errors.ErrUnsupported
+func DecodeAutoCompressed(r io.Reader) (*Container, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(zstdMagic))
+	if bytes.HasPrefix(magic, zstdMagic) {
+		return nil, fmt.Errorf("ntsm: zstd-compressed file: %w; decompress it first", errors.ErrUnsupported)
+	}
+	if !bytes.HasPrefix(magic, gzipMagic) {
+		c := new(Container)
+		if _, err := c.ReadFrom(br); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, fmt.Errorf("ntsm: gzip: %w", err)
+	}
+	defer zr.Close()
+	c := new(Container)
+	if _, err := c.ReadFrom(zr); err != nil {
+		return nil, err
+	}
+	// gzip only checks its CRC at the end of the stream
+	if _, err := io.Copy(io.Discard, zr); err != nil {
+		return nil, fmt.Errorf("ntsm: gzip: %w", err)
+	}
+	return c, nil
+}
@@ -0,0 +1,182 @@
+package ntsm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// Container is an in-memory NTSM file
+type Container struct {
+	Header   Header
+	GLB      []byte
+	Emitters []ParticleEmitter
+	Textures []Texture
+
+	// Meshes holds every level of detail of a multi-mesh file. When set it
+	// takes precedence over GLB on write
+	Meshes []GLBEntry
+
+	thumbnail []byte
+	meta      map[string]string
+	size      int64 // Encoded size from the last ReadFrom or WriteTo
+}
+
+// SetThumbnail sets the PNG preview written by WriteTo; nil removes it
+func (c *Container) SetThumbnail(png []byte) {
+	c.thumbnail = png
+}
+
+// Thumbnail returns the PNG preview, if the container has one
+func (c *Container) Thumbnail() ([]byte, bool) {
+	return c.thumbnail, len(c.thumbnail) > 0
+}
+
+// EmitterGroups returns the container's emitters grouped by GroupID, as
+// GroupEmitters does
+func (c *Container) EmitterGroups() map[uint16][]ParticleEmitter {
+	return GroupEmitters(c.Emitters)
+}
+
+// SetEmitterTexture points emitter emitterIdx at the texture named
+// textureName, so emitters can be authored by name rather than table
+// position. The name is resolved immediately, so call it once Textures is in
+// its final order
+func (c *Container) SetEmitterTexture(emitterIdx int, textureName string) error {
+	if emitterIdx < 0 || emitterIdx >= len(c.Emitters) {
+		return fmt.Errorf("ntsm: emitter index %d out of range [0, %d)", emitterIdx, len(c.Emitters))
+	}
+	i := slices.IndexFunc(c.Textures, func(t Texture) bool { return t.Name == textureName })
+	if i < 0 {
+		return fmt.Errorf("ntsm: no texture named %q", textureName)
+	}
+	c.Emitters[emitterIdx].TextureIndex = int32(i)
+	return nil
+}
+
+// SortEmitters reorders the emitters by less, keeping emitters that compare
+// equal in their current order, e.g. to batch them by texture or blend mode.
+// Encoding keeps the emitters in slice order, so the new order, and the
+// checksum, survive a round trip
+func (c *Container) SortEmitters(less func(a, b ParticleEmitter) bool) {
+	slices.SortStableFunc(c.Emitters, func(a, b ParticleEmitter) int {
+		switch {
+		case less(a, b):
+			return -1
+		case less(b, a):
+			return 1
+		}
+		return 0
+	})
+}
+
+// RemoveParticles drops the emitters and clears the has_particles flag and
+// particle region, the inverse of setting emitters and SetParticles, so the
+// next WriteTo produces a file without particles
+func (c *Container) RemoveParticles() {
+	c.Emitters = nil
+	c.Header.SetParticles(false)
+	c.Header.ParticleOffset = 0
+	c.Header.ParticleSize = 0
+	c.size = 0
+}
+
+// SetGLB replaces the GLB, e.g. with an optimized mesh, or the first level
+// of detail of a multi-mesh container. The header's offsets, sizes and
+// checksum are stale, and Stats reports no file size, until the next
+// WriteTo lays the file out again
+func (c *Container) SetGLB(b []byte) {
+	c.GLB = b
+	if len(c.Meshes) > 0 {
+		c.Meshes[0].Data = b
+	}
+	c.size = 0
+}
+
+// WriteTo encodes the container to w, deriving every section's offset and
+// size from the contents rather than trusting the header, so sections
+// resized since decoding are laid out afresh. The GLB is compressed when
+// the header has FlagGLBCompressed set
+func (c *Container) WriteTo(w io.Writer) (int64, error) {
+	opts := EncodeOptions{}
+	if c.Header.IsCompressed() {
+		opts.Compression = CompressionDeflate
+	}
+
+	cw := &countingWriter{w: w}
+	if err := encode(cw, &c.Header, c.payload(), opts); err != nil {
+		return cw.n, err
+	}
+	c.size = cw.n
+	return cw.n, nil
+}
+
+// ReadFrom decodes an NTSM file from r into the container, replacing its
+// contents
+func (c *Container) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countingReader{r: r}
+	hdr, p, err := decode(cr, wantTextures|wantMeshes|wantThumbnail|wantMeta, DecodeOptions{})
+	if err != nil {
+		return cr.n, err
+	}
+	c.setPayload(hdr, p)
+	c.size = cr.n
+	return cr.n, nil
+}
+
+// DecodeBytes decodes a whole NTSM file held in memory, verifying its
+// checksum. It is the natural entry point where the file arrives as one
+// buffer, such as a JS Uint8Array under GOOS=js, and needs no file system.
+// The container doesn't alias b
+func DecodeBytes(b []byte) (*Container, error) {
+	hdr, p, err := decode(bytes.NewReader(b), wantTextures|wantMeshes|wantThumbnail|wantMeta, DecodeOptions{VerifyChecksum: true})
+	if err != nil {
+		return nil, err
+	}
+	c := new(Container)
+	c.setPayload(hdr, p)
+	c.size = int64(len(b))
+	return c, nil
+}
+
+func (c *Container) payload() payload {
+	return payload{glb: c.GLB, meshes: c.Meshes, emitters: c.Emitters, textures: c.Textures, meta: c.meta, thumbnail: c.thumbnail}
+}
+
+func (c *Container) setPayload(hdr *Header, p payload) {
+	*c = Container{
+		Header:   *hdr,
+		GLB:      p.glb,
+		Emitters: p.emitters,
+		Textures: p.textures,
+
+		thumbnail: p.thumbnail,
+		meta:      p.meta,
+	}
+	if hdr.IsMultiMesh() {
+		c.Meshes = p.meshes
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,74 @@
+package ntsm
+
+import (
+	"context"
+	"io"
+)
+
+// ioChunk bounds how much is read or written between context checks
+const ioChunk = 64 << 10
+
+// DecodeContext is Decode but stops with ctx.Err() once ctx is done. The
+// context is checked before every read, so a large GLB is abandoned part
+// way through rather than read to the end
+func DecodeContext(ctx context.Context, r io.Reader) (*Header, []byte, []ParticleEmitter, error) {
+	hdr, p, err := decode(ctxReader{ctx, r}, 0, DecodeOptions{})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+	return hdr, p.glb, p.emitters, nil
+}
+
+// EncodeContext is EncodeWithOptions but stops with ctx.Err() once ctx is
+// done. Sections are written in chunks with the context checked before
+// each, so w may be left holding a partial file
+func EncodeContext(ctx context.Context, w io.Writer, hdr *Header, glbData []byte, emitters []ParticleEmitter, textures []Texture, opts EncodeOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return encode(ctxWriter{ctx, w}, hdr, payload{glb: glbData, emitters: emitters, textures: textures, meta: opts.Meta, thumbnail: opts.Thumbnail}, opts)
+}
+
+// ContextReader returns a reader that fails with ctx.Err() once ctx is done,
+// reading at most 64KB between checks. It suits the glb argument of
+// EncodeStream, which otherwise copies a stream to the end
+func ContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return ctxReader{ctx, r}
+}
+
+// ctxReader fails reads once its context is done
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p[:min(len(p), ioChunk)])
+}
+
+// ctxWriter splits writes into chunks and fails once its context is done
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (c ctxWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		if err := c.ctx.Err(); err != nil {
+			return n, err
+		}
+		m, err := c.w.Write(p[:min(len(p), ioChunk)])
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[m:]
+	}
+	return n, nil
+}
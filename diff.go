@@ -0,0 +1,76 @@
+package ntsm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Change is one difference found by Diff, with both values formatted for
+// display
+type Change struct {
+	Field    string // e.g. "name", "glb" or "emitters[1].Gravity"
+	Old, New string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Field, c.Old, c.New)
+}
+
+// DiffResult lists the differences between two containers, empty when they
+// match
+type DiffResult struct {
+	Changes []Change
+}
+
+// Equal reports whether no differences were found
+func (d DiffResult) Equal() bool { return len(d.Changes) == 0 }
+
+// String returns one change per line
+func (d DiffResult) String() string {
+	var b strings.Builder
+	for _, c := range d.Changes {
+		fmt.Fprintln(&b, c)
+	}
+	return b.String()
+}
+
+// Diff compares a, the old version, with b in name, flags, GLB, emitter
+// count and every field of the emitters both have. GLBs are compared by
+// size and SHA-256 rather than contents, so a changed mesh is one line
+func Diff(a, b *Container) DiffResult {
+	var d DiffResult
+	add := func(field string, old, new any) {
+		o, n := fmt.Sprint(old), fmt.Sprint(new)
+		if o != n {
+			d.Changes = append(d.Changes, Change{field, o, n})
+		}
+	}
+
+	add("name", a.Header.NameString(), b.Header.NameString())
+	add("flags", a.Header.Flags, b.Header.Flags)
+	if !bytes.Equal(a.GLB, b.GLB) {
+		d.Changes = append(d.Changes, Change{"glb", glbSummary(a.GLB), glbSummary(b.GLB)})
+	}
+	add("emitters", len(a.Emitters), len(b.Emitters))
+
+	for i := range min(len(a.Emitters), len(b.Emitters)) {
+		va, vb := reflect.ValueOf(a.Emitters[i]), reflect.ValueOf(b.Emitters[i])
+		for j := range va.NumField() {
+			f := va.Type().Field(j)
+			if !f.IsExported() {
+				continue
+			}
+			add(fmt.Sprintf("emitters[%d].%s", i, f.Name), va.Field(j).Interface(), vb.Field(j).Interface())
+		}
+	}
+	return d
+}
+
+// glbSummary describes a GLB by its size and a short hash of its bytes
+func glbSummary(glb []byte) string {
+	sum := sha256.Sum256(glb)
+	return fmt.Sprintf("%d bytes, sha256 %x", len(glb), sum[:8])
+}
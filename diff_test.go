@@ -0,0 +1,38 @@
+package ntsm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	if d := Diff(testContainer(), testContainer()); !d.Equal() {
+		t.Errorf("identical containers differ: %v", d)
+	}
+
+	for _, tc := range []struct {
+		change func(c *Container)
+		field  string
+	}{
+		{func(c *Container) { putCString(c.Header.Name[:], "renamed") }, "name"},
+		{func(c *Container) { c.Header.SetCompressed(true) }, "flags"},
+		{func(c *Container) { c.GLB = testGLBJSON(`{"asset":{"version":"2.1"}}`) }, "glb"},
+		{func(c *Container) { c.Emitters = c.Emitters[:1] }, "emitters"},
+		{func(c *Container) { c.Emitters[1].Gravity = -1 }, "emitters[1].Gravity"},
+		{func(c *Container) { c.Emitters[0].BlendMode = BlendAlpha }, "emitters[0].BlendMode"},
+	} {
+		b := testContainer()
+		tc.change(b)
+		d := Diff(testContainer(), b)
+		if len(d.Changes) != 1 || d.Changes[0].Field != tc.field {
+			t.Errorf("changing %s: got %v", tc.field, d.Changes)
+		}
+	}
+
+	b := testContainer()
+	b.GLB = append(b.GLB, make([]byte, 1<<20)...)
+	d := Diff(testContainer(), b)
+	if len(d.Changes) != 1 || !strings.HasPrefix(d.Changes[0].New, "1048623 bytes, sha256 ") || len(d.String()) > 200 {
+		t.Errorf("GLB change reported as %q", d)
+	}
+}
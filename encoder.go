@@ -0,0 +1,279 @@
+package ntsm
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// Encoder writes an NTSM file section by section so the GLB can be streamed
+// from disk instead of held in memory. Sections must be written in order:
+// WriteHeader, WriteGLB, then optionally WriteEmitters, followed by Close.
+//
+// Two modes are supported:
+//
+//   - Sized: the caller sets GLBSize and ParticleSize in the header passed
+//     to WriteHeader (e.g. from a stat of the source file). Any io.Writer
+//     works, and WriteGLB and WriteEmitters fail if the written sizes
+//     differ from the declared ones.
+//   - Backpatched: the sizes may be left zero. The writer must be an
+//     io.WriteSeeker; Close seeks back and rewrites the header with the
+//     actual sizes.
+//
+// The checksum is only known once the payload is written, so it is recorded
+// in backpatched mode and left zero (no checksum) otherwise.
+type Encoder struct {
+	w     io.Writer
+	crc   hash.Hash32
+	hdr   Header
+	base  int64 // Offset of the header in w, when seekable
+	seek  bool
+	state int
+
+	// placeholder writes the header with a zero magic until Close
+	// backpatches it, so an unfinished file is never mistaken for NTSM
+	placeholder bool
+
+	glbSize      int64
+	particleSize int64
+}
+
+const (
+	encoderInit = iota
+	encoderHeader
+	encoderGLB
+	encoderEmitters
+	encoderClosed
+)
+
+// NewEncoder returns an Encoder writing to w
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, crc: crc32.NewIEEE()}
+}
+
+// WriteHeader fills in the magic, version and offsets of hdr and writes it.
+// The version is 1 unless hdr asks for a later one, which a sized Encoder
+// needs for emitters using newer fields such as AtlasRect or Seed; a
+// backpatched one moves up as needed
+func (e *Encoder) WriteHeader(hdr *Header) error {
+	if e.state != encoderInit {
+		return errors.New("ntsm: header already written")
+	}
+	if !hdr.ByteOrder.valid() {
+		return fmt.Errorf("ntsm: unknown byte order %d", uint8(hdr.ByteOrder))
+	}
+	if hdr.Version > MaxVersion {
+		return &ErrUnsupportedVersion{Got: hdr.Version, Min: MinVersion, Max: MaxVersion}
+	}
+
+	copy(hdr.Magic[:], Magic)
+	hdr.Version = max(hdr.Version, MinVersion)
+	hdr.GLBOffset = HeaderSize
+	hdr.ParticleOffset = HeaderSize + hdr.GLBSize
+	hdr.SetParticles(hdr.ParticleSize > 0)
+	hdr.SetCompressed(false)
+	hdr.SetMultiMesh(false)
+	hdr.GLBRawSize = 0
+	hdr.MeshTableOffset = 0
+	hdr.TextureCount = 0
+	hdr.TextureOffset = 0
+	hdr.Checksum = 0
+	hdr.Flags.set(FlagHasThumbnail, false)
+	hdr.ThumbnailOffset = 0
+	hdr.ThumbnailSize = 0
+	hdr.Flags.set(FlagHasMeta, false)
+	hdr.MetaOffset = 0
+	hdr.MetaSize = 0
+
+	if s, ok := e.w.(io.WriteSeeker); ok {
+		if base, err := s.Seek(0, io.SeekCurrent); err == nil {
+			e.base = base
+			e.seek = true
+		}
+	}
+
+	out := hdr
+	if e.placeholder {
+		p := *hdr
+		clear(p.Magic[:])
+		out = &p
+	}
+	if err := writeHeader(e.w, hdr.ByteOrder.binary(), out); err != nil {
+		return err
+	}
+	e.hdr = *hdr
+	e.state = encoderHeader
+	return nil
+}
+
+// WriteGLB copies the GLB data from r
+func (e *Encoder) WriteGLB(r io.Reader) (n int64, err error) {
+	if e.state != encoderHeader {
+		return 0, errors.New("ntsm: GLB must be written once, after the header")
+	}
+	e.state = encoderGLB
+
+	n, err = io.Copy(io.MultiWriter(e.w, e.crc), r)
+	e.glbSize = n
+	if err != nil {
+		return n, err
+	}
+	if !e.seek && n != int64(e.hdr.GLBSize) {
+		return n, fmt.Errorf("ntsm: wrote %d GLB bytes but header declares %d", n, e.hdr.GLBSize)
+	}
+	return n, nil
+}
+
+// WriteEmitters validates and writes the particle block. The Encoder does
+// not embed textures, so each TextureIndex must be -1
+func (e *Encoder) WriteEmitters(emitters []ParticleEmitter) error {
+	if e.state != encoderGLB {
+		return errors.New("ntsm: emitters must be written once, after the GLB")
+	}
+	e.state = encoderEmitters
+
+	if err := validateEmitters(emitters, 0); err != nil {
+		return err
+	}
+	if v := emitterVersion(emitters); v > e.hdr.Version {
+		if !e.seek {
+			return fmt.Errorf("ntsm: emitters need version %d but the header declares %d", v, e.hdr.Version)
+		}
+		e.hdr.Version = v
+	}
+	data, err := encodeEmitters(emitters, e.hdr.ByteOrder, e.hdr.Version)
+	if err != nil {
+		return err
+	}
+	if _, err := io.MultiWriter(e.w, e.crc).Write(data); err != nil {
+		return err
+	}
+	e.particleSize = int64(len(data))
+	if !e.seek && e.particleSize != int64(e.hdr.ParticleSize) {
+		return fmt.Errorf("ntsm: wrote %d particle bytes but header declares %d", e.particleSize, e.hdr.ParticleSize)
+	}
+	return nil
+}
+
+// Close finishes the file, backpatching the header with the written sizes
+// and checksum when the writer is seekable. It does not close the
+// underlying writer
+func (e *Encoder) Close() error {
+	switch e.state {
+	case encoderInit, encoderHeader:
+		return errors.New("ntsm: closed before the GLB was written")
+	case encoderClosed:
+		return nil
+	}
+	e.state = encoderClosed
+
+	if !e.seek {
+		return nil
+	}
+
+	e.hdr.GLBSize = uint32(e.glbSize)
+	e.hdr.ParticleOffset = HeaderSize + e.hdr.GLBSize
+	e.hdr.ParticleSize = uint32(e.particleSize)
+	e.hdr.Checksum = e.crc.Sum32()
+	e.hdr.SetParticles(e.particleSize > 0)
+
+	s := e.w.(io.WriteSeeker)
+	end, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Seek(e.base, io.SeekStart); err != nil {
+		return err
+	}
+	if err := writeHeader(s, e.hdr.ByteOrder.binary(), &e.hdr); err != nil {
+		return err
+	}
+	_, err = s.Seek(end, io.SeekStart)
+	return err
+}
+
+// EncodeStream writes an NTSM file with the GLB copied from glb through a
+// small buffer rather than held in memory. The header is backpatched with
+// the written sizes and checksum, and hdr is updated to match
+func EncodeStream(dst io.WriteSeeker, hdr *Header, glb io.Reader, emitters []ParticleEmitter) error {
+	hdr.GLBSize = 0
+	hdr.ParticleSize = uint32(EncodedParticleSize(emitters))
+
+	if _, err := dst.Seek(0, io.SeekCurrent); err != nil {
+		return fmt.Errorf("ntsm: EncodeStream needs a seekable writer: %w", err)
+	}
+
+	e := NewEncoder(dst)
+	if err := e.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := e.WriteGLB(glb); err != nil {
+		return err
+	}
+	if len(emitters) > 0 {
+		if err := e.WriteEmitters(emitters); err != nil {
+			return err
+		}
+	}
+	if err := e.Close(); err != nil {
+		return err
+	}
+	*hdr = e.hdr
+	return nil
+}
+
+// ContainerWriter streams a GLB into an NTSM file as an io.WriteCloser:
+// Write appends GLB bytes and Close backpatches the header with the final
+// sizes and checksum. Until then the header's magic is zeroed, so a file
+// that was never closed fails to decode with ErrBadMagic
+type ContainerWriter struct {
+	e   *Encoder
+	hdr *Header
+}
+
+// NewContainerWriter writes hdr to w and returns a ContainerWriter for the
+// GLB that follows. w must be seekable so Close can rewrite the header;
+// hdr is updated to match on Close
+func NewContainerWriter(w io.WriteSeeker, hdr *Header) (*ContainerWriter, error) {
+	if _, err := w.Seek(0, io.SeekCurrent); err != nil {
+		return nil, fmt.Errorf("ntsm: ContainerWriter needs a seekable writer: %w", err)
+	}
+	hdr.GLBSize = 0
+	hdr.ParticleSize = 0
+
+	e := NewEncoder(w)
+	e.placeholder = true
+	if err := e.WriteHeader(hdr); err != nil {
+		return nil, err
+	}
+	e.state = encoderGLB
+	return &ContainerWriter{e: e, hdr: hdr}, nil
+}
+
+// Write appends p to the GLB
+func (cw *ContainerWriter) Write(p []byte) (int, error) {
+	if cw.e.state != encoderGLB {
+		return 0, errors.New("ntsm: GLB written after the emitters or Close")
+	}
+	n, err := cw.e.w.Write(p)
+	cw.e.crc.Write(p[:n])
+	cw.e.glbSize += int64(n)
+	return n, err
+}
+
+// WriteEmitters ends the GLB and writes the particle block, as
+// Encoder.WriteEmitters does
+func (cw *ContainerWriter) WriteEmitters(emitters []ParticleEmitter) error {
+	return cw.e.WriteEmitters(emitters)
+}
+
+// Close backpatches the header. It does not close the underlying writer
+func (cw *ContainerWriter) Close() error {
+	if err := cw.e.Close(); err != nil {
+		return err
+	}
+	*cw.hdr = cw.e.hdr
+	return nil
+}
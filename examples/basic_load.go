@@ -1,10 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 
+	"github.com/netisu/ntsm"
 	aenoAdapter "github.com/netisu/ntsm/adapters/aeno"
 )
 
@@ -27,9 +29,14 @@ func main() {
 	}
 	fmt.Printf("File size: %d bytes\n", fileInfo.Size())
 
-	header := make([]byte, 4)
-	f.ReadAt(header, 0)
-	fmt.Printf("Header magic: %q (should be \"NTSM\")\n", string(header))
+	// Detect the format from the content, so any extension works
+	isNTSM, err := ntsm.Sniff(f)
+	if err != nil {
+		log.Fatalf("Failed to read file: %v", err)
+	}
+	if !isNTSM {
+		log.Fatalf("%s is not an NTSM file", filePath)
+	}
 
 	glbCheck := make([]byte, 4)
 	f.ReadAt(glbCheck, 192)
@@ -38,6 +45,12 @@ func main() {
 	f.Seek(0, 0)
 
 	loaded, err := aenoAdapter.LoadObject(f)
+	if errors.Is(err, ntsm.ErrBadMagic) {
+		log.Fatalf("%s is not an NTSM file: %v", filePath, err)
+	}
+	if errors.Is(err, ntsm.ErrTruncated) {
+		log.Fatalf("%s is truncated: %v", filePath, err)
+	}
 	if err != nil {
 		log.Fatalf("Failed to load NTSM: %v", err)
 	}
@@ -53,6 +66,10 @@ func main() {
 	} else {
 		fmt.Println("No mesh data found")
 	}
-	
-	fmt.Printf("Contains %d particle emitters\n", len(loaded.Emitters))
+
+	if loaded.HasParticles() {
+		fmt.Printf("Particle groups: %d\n", len(loaded.EmitterGroups()))
+	} else {
+		fmt.Println("No particle emitters")
+	}
 }
@@ -0,0 +1,63 @@
+package ntsm
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// glTF extensions that compress mesh geometry. A loader that doesn't decode
+// them finds no usable vertex data
+const (
+	ExtDracoMeshCompression = "KHR_draco_mesh_compression"
+	ExtMeshoptCompression   = "EXT_meshopt_compression"
+)
+
+// GLBExtensions returns the glTF extensions a GLB declares in
+// extensionsUsed and extensionsRequired, in order and without duplicates,
+// so callers can check for ones their loader lacks before loading
+func GLBExtensions(glb []byte) ([]string, error) {
+	var doc struct {
+		ExtensionsUsed     []string `json:"extensionsUsed"`
+		ExtensionsRequired []string `json:"extensionsRequired"`
+	}
+	if err := glbDocument(glb, &doc); err != nil {
+		return nil, err
+	}
+
+	var exts []string
+	for _, ext := range append(doc.ExtensionsUsed, doc.ExtensionsRequired...) {
+		if !slices.Contains(exts, ext) {
+			exts = append(exts, ext)
+		}
+	}
+	return exts, nil
+}
+
+// CompressedGeometry returns the first geometry compression extension the
+// GLB uses, or "" if it uses none
+func CompressedGeometry(glb []byte) (string, error) {
+	exts, err := GLBExtensions(glb)
+	if err != nil {
+		return "", err
+	}
+	for _, ext := range exts {
+		if ext == ExtDracoMeshCompression || ext == ExtMeshoptCompression {
+			return ext, nil
+		}
+	}
+	return "", nil
+}
+
+// glbDocument unmarshals the JSON chunk of a GLB into v
+func glbDocument(glb []byte, v any) error {
+	if err := validateGLB(glb); err != nil {
+		return err
+	}
+	chunkLen := binary.LittleEndian.Uint32(glb[12:])
+	if err := json.Unmarshal(glb[20:20+chunkLen], v); err != nil {
+		return fmt.Errorf("%w: JSON chunk: %v", ErrInvalidGLB, err)
+	}
+	return nil
+}
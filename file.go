@@ -0,0 +1,123 @@
+package ntsm
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// DecodeFile reads the NTSM file at path
+func DecodeFile(path string) (*Header, []byte, []ParticleEmitter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	hdr, glbData, emitters, err := DecodeAt(f, info.Size())
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return hdr, glbData, emitters, nil
+}
+
+// EncodeFile writes an NTSM file to path, creating parent directories as
+// needed
+func EncodeFile(path string, hdr *Header, glb []byte, emitters []ParticleEmitter) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := Encode(f, hdr, glb, emitters); err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// AppendEmitters replaces the emitters of the NTSM file at path in place,
+// rewriting only the particle region at the end of the file and the header.
+// The GLB on disk is left untouched, though it is read to recompute the
+// checksum. The particle region must be the last section, so files with
+// textures, metadata or a thumbnail are rejected
+func AppendEmitters(path string, emitters []ParticleEmitter) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	if err := appendEmitters(f, emitters); err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return f.Close()
+}
+
+func appendEmitters(f *os.File, emitters []ParticleEmitter) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	hdr, err := DecodeHeader(io.NewSectionReader(f, 0, HeaderSize))
+	if err != nil {
+		return err
+	}
+	if err := hdr.Validate(size); err != nil {
+		return err
+	}
+	if hdr.TextureCount > 0 || hdr.HasThumbnail() || hdr.HasMeta() {
+		return errors.New("ntsm: particle region isn't the last section")
+	}
+
+	// Without particles the GLB runs to the end of the file
+	start := size
+	if hdr.HasParticles() {
+		start = int64(hdr.ParticleOffset)
+		if start+int64(hdr.ParticleSize) != size {
+			return errors.New("ntsm: particle region isn't the last section")
+		}
+	}
+
+	if err := validateEmitters(emitters, 0); err != nil {
+		return err
+	}
+	// The emitters are the only part of a file that differs between
+	// versions, so the version can follow them
+	hdr.Version = emitterVersion(emitters)
+	particleData, err := encodeEmitters(emitters, hdr.ByteOrder, hdr.Version)
+	if err != nil {
+		return err
+	}
+
+	crc := crc32.NewIEEE()
+	if _, err := io.Copy(crc, io.NewSectionReader(f, HeaderSize, start-HeaderSize)); err != nil {
+		return err
+	}
+	crc.Write(particleData)
+
+	if _, err := f.WriteAt(particleData, start); err != nil {
+		return err
+	}
+	if err := f.Truncate(start + int64(len(particleData))); err != nil {
+		return err
+	}
+
+	hdr.ParticleOffset = uint32(start)
+	hdr.ParticleSize = uint32(len(particleData))
+	hdr.SetParticles(len(emitters) > 0)
+	hdr.Checksum = crc.Sum32()
+	return writeHeader(io.NewOffsetWriter(f, 0), hdr.ByteOrder.binary(), hdr)
+}
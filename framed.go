@@ -0,0 +1,58 @@
+package ntsm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// FramePrefixSize is the size of the length that precedes a framed file: a
+// little-endian uint64 counting the bytes after it
+const FramePrefixSize = 8
+
+// maxFrameSize bounds a frame's length. Sections end at a uint32 offset plus
+// a uint32 size, so no file is larger
+const maxFrameSize = 1 << 33
+
+// EncodeFramed writes c prefixed with its encoded length, so a reader on a
+// socket or other stream knows when the whole file has arrived without
+// seeking. Frames go back to back and are read with DecodeFramed; the file
+// after the prefix is an ordinary NTSM file
+func EncodeFramed(w io.Writer, c *Container) error {
+	var buf bytes.Buffer
+	buf.Write(make([]byte, FramePrefixSize))
+	if _, err := c.WriteTo(&buf); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint64(data, uint64(len(data)-FramePrefixSize))
+	_, err := w.Write(data)
+	return err
+}
+
+// DecodeFramed reads one frame written by EncodeFramed from r, buffering
+// exactly the length given by its prefix before decoding it as DecodeBytes
+// does, so r is left at the start of the next frame. It returns io.EOF if r
+// ends cleanly before a frame
+func DecodeFramed(r io.Reader) (*Container, error) {
+	var prefix [FramePrefixSize]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("ntsm: reading frame length: %w", truncated(err))
+	}
+	n := binary.LittleEndian.Uint64(prefix[:])
+	if n < HeaderSize || n > maxFrameSize {
+		return nil, fmt.Errorf("ntsm: frame length %d out of range [%d, %d]", n, HeaderSize, uint64(maxFrameSize))
+	}
+
+	// Grow the buffer as data arrives so a corrupt length can't force a huge
+	// up-front allocation
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+		return nil, fmt.Errorf("ntsm: reading %d-byte frame: %w", n, truncated(err))
+	}
+	return DecodeBytes(buf.Bytes())
+}
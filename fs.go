@@ -0,0 +1,55 @@
+package ntsm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// DecodeFS reads the NTSM file name from fsys, such as an embed.FS. Files
+// that implement io.ReaderAt are read section by section; others are read
+// whole
+func DecodeFS(fsys fs.FS, name string) (*Container, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return decodeContainer(bytes.NewReader(data), int64(len(data)), name)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return decodeContainer(io.NewSectionReader(ra, 0, info.Size()), info.Size(), name)
+}
+
+// decodeContainer decodes a size-byte file from r, skipping forward by
+// seeking. Errors are prefixed with name
+func decodeContainer(r io.ReadSeeker, size int64, name string) (*Container, error) {
+	hdr, err := DecodeHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if err := hdr.Validate(size); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	p, err := decodeSections(r, hdr, wantTextures|wantMeshes|wantThumbnail|wantMeta, DecodeOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	c := &Container{}
+	c.setPayload(hdr, p)
+	c.size = size
+	return c, nil
+}
@@ -0,0 +1,28 @@
+package ntsm
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// FuzzDecode feeds arbitrary bytes to every decoder. None may panic or
+// allocate far beyond the input; malformed input must return an error
+func FuzzDecode(f *testing.F) {
+	valid, err := os.ReadFile("tests/glb/valid.ntsm")
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(valid)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Decode(bytes.NewReader(data))
+		DecodeWithOptions(bytes.NewReader(data), DecodeOptions{VerifyChecksum: true})
+		DecodeAt(bytes.NewReader(data), int64(len(data)))
+		Verify(bytes.NewReader(data), int64(len(data)))
+		ReadThumbnail(bytes.NewReader(data))
+
+		var c Container
+		c.ReadFrom(bytes.NewReader(data))
+	})
+}
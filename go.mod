@@ -2,11 +2,13 @@ module github.com/netisu/ntsm
 
 go 1.25.0
 
-require github.com/netisu/aeno v0.1.54
+require (
+	github.com/netisu/aeno v0.1.54
+	github.com/qmuntal/gltf v0.28.0
+)
 
 require (
 	github.com/beorn7/floats v1.0.0 // indirect
 	github.com/fogleman/simplify v0.0.0-20170216171241-d32f302d5046 // indirect
 	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646 // indirect
-	github.com/qmuntal/gltf v0.28.0 // indirect
 )
@@ -0,0 +1,104 @@
+package ntsm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// maxMeshes caps the mesh table so a corrupt count can't force a huge read
+const maxMeshes = 1 << 16
+
+// MeshEntry is a single row of the mesh table used in multi_mesh files
+type MeshEntry struct {
+	Name        [64]byte // Null-padded mesh name
+	Offset      uint32   // Offset to GLB data
+	Size        uint32   // Size of GLB data
+	RawSize     uint32   // Uncompressed size when glb_compressed is set
+	LODDistance float32  // Camera distance from which this level is used
+}
+
+var meshEntrySize = int64(binary.Size(MeshEntry{}))
+
+// GLBEntry is one level of detail in a multi-mesh container
+type GLBEntry struct {
+	Name        string
+	LODDistance float32
+	Data        []byte
+}
+
+// DecodeMeshes is like Decode but returns every GLB in a multi-mesh file.
+// Single-GLB files yield one entry named after the item
+func DecodeMeshes(r io.Reader) (*Header, []GLBEntry, []ParticleEmitter, error) {
+	hdr, p, err := decode(r, wantMeshes, DecodeOptions{})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return hdr, p.meshes, p.emitters, nil
+}
+
+// EncodeMeshes writes a multi-mesh file. The first mesh is also recorded as
+// the primary GLB so readers unaware of the mesh table still load it
+func EncodeMeshes(w io.Writer, hdr *Header, meshes []GLBEntry, emitters []ParticleEmitter) error {
+	if len(meshes) == 0 {
+		return fmt.Errorf("ntsm: no meshes to encode")
+	}
+	return encode(w, hdr, payload{meshes: meshes, emitters: emitters}, EncodeOptions{})
+}
+
+// readMeshes reads the mesh table and, when all is set, every mesh. Otherwise
+// only the first mesh's data is read
+func readMeshes(sr *seqReader, hdr *Header, all bool, limit int64) ([]GLBEntry, error) {
+	entries, err := readMeshTable(sr, hdr)
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	for i, e := range entries {
+		if i == 0 || all {
+			total += decodedGLBSize(e.Size, e.RawSize, hdr.Flags)
+		}
+	}
+	if err := checkLimit("GLB", total, limit); err != nil {
+		return nil, err
+	}
+
+	meshes := make([]GLBEntry, len(entries))
+	for i, e := range entries {
+		meshes[i] = GLBEntry{Name: cString(e.Name[:]), LODDistance: e.LODDistance}
+		if i > 0 && !all {
+			continue
+		}
+		if meshes[i].Data, err = readGLB(sr, e.Offset, e.Size, e.RawSize, hdr.Flags); err != nil {
+			return nil, fmt.Errorf("ntsm: mesh %d: %w", i, err)
+		}
+	}
+	return meshes, nil
+}
+
+// readMeshTable reads the mesh table, checking that the first entry is the
+// header's GLB region
+func readMeshTable(sr *seqReader, hdr *Header) ([]MeshEntry, error) {
+	countData, err := sr.section(int64(hdr.MeshTableOffset), 4)
+	if err != nil {
+		return nil, err
+	}
+	count := hdr.ByteOrder.binary().Uint32(countData)
+	if count == 0 || count > maxMeshes {
+		return nil, fmt.Errorf("ntsm: invalid mesh count %d", count)
+	}
+
+	table, err := sr.section(sr.pos, count*uint32(meshEntrySize))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]MeshEntry, count)
+	if err := binary.Read(bytes.NewReader(table), hdr.ByteOrder.binary(), entries); err != nil {
+		return nil, err
+	}
+	if entries[0].Offset != hdr.GLBOffset || entries[0].Size != hdr.GLBSize {
+		return nil, fmt.Errorf("ntsm: first mesh doesn't match the header's GLB region")
+	}
+	return entries, nil
+}
@@ -0,0 +1,132 @@
+package ntsm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"unicode/utf8"
+)
+
+// MetaAttribution is the metadata key for a license or attribution notice,
+// such as the credit a CC-BY model requires, that travels with the file
+const MetaAttribution = "attribution"
+
+// SetMeta sets a metadata tag, such as "author" or "license", written by
+// WriteTo. Keys must be non-empty; keys and values must be valid UTF-8
+func (c *Container) SetMeta(key, value string) {
+	if c.meta == nil {
+		c.meta = map[string]string{}
+	}
+	c.meta[key] = value
+}
+
+// DeleteMeta removes a metadata tag
+func (c *Container) DeleteMeta(key string) {
+	delete(c.meta, key)
+}
+
+// Meta returns a copy of the metadata tags, or nil if there are none
+func (c *Container) Meta() map[string]string {
+	if len(c.meta) == 0 {
+		return nil
+	}
+	return maps.Clone(c.meta)
+}
+
+// ReadMeta reads just the header and the metadata tags, returning nil if
+// the file has none
+func ReadMeta(r io.ReaderAt) (map[string]string, error) {
+	hdr, err := DecodeHeader(io.NewSectionReader(r, 0, HeaderSize))
+	if err != nil {
+		return nil, err
+	}
+	if !hdr.HasMeta() {
+		return nil, nil
+	}
+	data, err := readSectionAt(r, hdr.MetaOffset, hdr.MetaSize)
+	if err != nil {
+		return nil, fmt.Errorf("ntsm: metadata: %w", err)
+	}
+	return decodeMeta(data, hdr.ByteOrder)
+}
+
+// encodeMeta serializes tags as a uint32 count followed by each pair as a
+// uint32-length-prefixed key and value, sorted by key so the encoding and
+// checksum are stable. No tags encode to nothing
+func encodeMeta(meta map[string]string, order ByteOrder) ([]byte, error) {
+	if len(meta) == 0 {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	putLen := func(n int) {
+		var b [4]byte
+		order.binary().PutUint32(b[:], uint32(n))
+		buf.Write(b[:])
+	}
+
+	putLen(len(meta))
+	for _, k := range slices.Sorted(maps.Keys(meta)) {
+		v := meta[k]
+		if k == "" {
+			return nil, errors.New("ntsm: metadata key is empty")
+		}
+		if !utf8.ValidString(k) || !utf8.ValidString(v) {
+			return nil, fmt.Errorf("ntsm: metadata %q: invalid UTF-8", k)
+		}
+		for _, s := range []string{k, v} {
+			putLen(len(s))
+			buf.WriteString(s)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeMeta parses a metadata section written by encodeMeta
+func decodeMeta(data []byte, order ByteOrder) (map[string]string, error) {
+	bo := order.binary()
+	next := func() (string, bool) {
+		if len(data) < 4 {
+			return "", false
+		}
+		n := bo.Uint32(data)
+		if uint64(n) > uint64(len(data)-4) {
+			return "", false
+		}
+		s := string(data[4 : 4+n])
+		data = data[4+n:]
+		return s, true
+	}
+
+	if len(data) < 4 {
+		return nil, fmt.Errorf("ntsm: metadata: %w", ErrTruncated)
+	}
+	count := bo.Uint32(data)
+	data = data[4:]
+
+	// Each pair takes at least 8 bytes, so count can't force a large map
+	if uint64(count)*8 > uint64(len(data)) {
+		return nil, fmt.Errorf("ntsm: metadata: %d pairs don't fit in %d bytes", count, len(data))
+	}
+	meta := make(map[string]string, count)
+	for i := range count {
+		k, ok := next()
+		if !ok {
+			return nil, fmt.Errorf("ntsm: metadata pair %d: %w", i, ErrTruncated)
+		}
+		v, ok := next()
+		if !ok {
+			return nil, fmt.Errorf("ntsm: metadata %q: %w", k, ErrTruncated)
+		}
+		if k == "" || !utf8.ValidString(k) || !utf8.ValidString(v) {
+			return nil, fmt.Errorf("ntsm: metadata pair %d: invalid key or value", i)
+		}
+		meta[k] = v
+	}
+	if len(data) > 0 {
+		return nil, fmt.Errorf("ntsm: metadata: %d bytes after the last pair", len(data))
+	}
+	return meta, nil
+}
@@ -0,0 +1,120 @@
+package ntsm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// MappedContainer is a Container decoded from a read-only memory mapping
+// of its file. Uncompressed GLBs point into the mapping instead of being
+// copied, so they must not be modified or used after Close
+type MappedContainer struct {
+	Container
+	mapping []byte
+}
+
+// OpenMapped memory-maps the NTSM file name and decodes it, for servers
+// that read the same large files repeatedly. Where mmap isn't supported
+// the file is read normally and Close only releases the container
+func OpenMapped(name string) (*MappedContainer, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // The mapping outlives the descriptor
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if info.Size() >= HeaderSize {
+		data, err = mmapFile(f, info.Size())
+	} else {
+		err = errors.ErrUnsupported // Too short to map; report it as a read would
+	}
+	if errors.Is(err, errors.ErrUnsupported) {
+		c, err := decodeContainer(f, info.Size(), name)
+		if err != nil {
+			return nil, err
+		}
+		return &MappedContainer{Container: *c}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: mmap: %w", name, err)
+	}
+
+	m := &MappedContainer{mapping: data}
+	if err := m.decode(); err != nil {
+		munmapFile(data)
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return m, nil
+}
+
+// decode decodes the mapping, reading everything but the GLBs as usual and
+// slicing the GLBs out of the mapping
+func (m *MappedContainer) decode() error {
+	size := int64(len(m.mapping))
+	hdr, err := DecodeHeader(bytes.NewReader(m.mapping))
+	if err != nil {
+		return err
+	}
+	if err := hdr.Validate(size); err != nil {
+		return err
+	}
+
+	hdr, p, err := decode(bytes.NewReader(m.mapping), wantTextures|wantThumbnail|wantMeta, DecodeOptions{SkipGLB: true})
+	if err != nil {
+		return err
+	}
+	if hdr.IsMultiMesh() {
+		entries, err := readMeshTable(&seqReader{r: bytes.NewReader(m.mapping)}, hdr)
+		if err != nil {
+			return err
+		}
+		p.meshes = make([]GLBEntry, len(entries))
+		for i, e := range entries {
+			p.meshes[i] = GLBEntry{Name: cString(e.Name[:]), LODDistance: e.LODDistance}
+			if p.meshes[i].Data, err = m.glb(e.Offset, e.Size, e.RawSize, hdr.Flags); err != nil {
+				return fmt.Errorf("ntsm: mesh %d: %w", i, err)
+			}
+		}
+		p.glb = p.meshes[0].Data
+	} else if p.glb, err = m.glb(hdr.GLBOffset, hdr.GLBSize, hdr.GLBRawSize, hdr.Flags); err != nil {
+		return err
+	}
+
+	m.setPayload(hdr, p)
+	m.size = size
+	return nil
+}
+
+// glb returns the GLB at offset, a view into the mapping unless it has to
+// be decompressed. The view's capacity ends with it so appending copies
+func (m *MappedContainer) glb(offset, size, rawSize uint32, flags Flags) ([]byte, error) {
+	end := int64(offset) + int64(size)
+	if end > int64(len(m.mapping)) {
+		return nil, fmt.Errorf("%w: GLB region [%d, %d) exceeds file size %d", ErrTruncated, offset, end, len(m.mapping))
+	}
+	data := m.mapping[offset:end:end]
+	if flags&FlagGLBCompressed != 0 {
+		return decompressGLB(data, rawSize)
+	}
+	return data, nil
+}
+
+// Close unmaps the file and clears the container, whose GLBs would
+// otherwise point at unmapped memory
+func (m *MappedContainer) Close() error {
+	m.Container = Container{}
+	if m.mapping == nil {
+		return nil
+	}
+	err := munmapFile(m.mapping)
+	m.mapping = nil
+	return err
+}
@@ -0,0 +1,75 @@
+package ntsm
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func TestOpenMapped(t *testing.T) {
+	plain := testContainer()
+	plain.Textures = []Texture{{Name: "spark", MimeType: "image/png", Data: []byte("png")}}
+	plain.SetMeta("author", "netisu")
+
+	compressed := testContainer()
+	compressed.Header.Flags |= FlagGLBCompressed
+
+	lod := testContainer()
+	lod.Meshes = []GLBEntry{{Name: "high", Data: testGLB()}, {Name: "low", LODDistance: 50, Data: testGLB()}}
+
+	for name, c := range map[string]*Container{"plain": plain, "compressed": compressed, "lod": lod} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name+".ntsm")
+			if err := os.WriteFile(path, encodeTest(t, c), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			m, err := OpenMapped(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+			want := c.GLB
+			if c.Meshes != nil {
+				want = c.Meshes[0].Data
+			}
+			if !bytes.Equal(m.GLB, want) {
+				t.Errorf("GLB = %q, want %q", m.GLB, want)
+			}
+			if !reflect.DeepEqual(m.Emitters, c.Emitters) || !reflect.DeepEqual(m.Textures, c.Textures) || !reflect.DeepEqual(m.Meta(), c.Meta()) {
+				t.Error("emitters, textures or metadata differ")
+			}
+			for i, mesh := range m.Meshes {
+				if mesh.Name != c.Meshes[i].Name || !bytes.Equal(mesh.Data, c.Meshes[i].Data) {
+					t.Errorf("mesh %d = %q %q", i, mesh.Name, mesh.Data)
+				}
+			}
+
+			// Uncompressed GLBs must be views, not copies
+			if m.mapping != nil && !c.Header.IsCompressed() {
+				start := uintptr(unsafe.Pointer(unsafe.SliceData(m.mapping)))
+				glb := uintptr(unsafe.Pointer(unsafe.SliceData(m.GLB)))
+				if glb < start || glb >= start+uintptr(len(m.mapping)) {
+					t.Error("GLB was copied out of the mapping")
+				}
+			}
+
+			if err := m.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if m.GLB != nil || m.Close() != nil {
+				t.Error("second Close failed or left the GLB set")
+			}
+		})
+	}
+
+	// Files too short to map are read normally, failing the same way
+	short := filepath.Join(t.TempDir(), "short.ntsm")
+	os.WriteFile(short, []byte("NTSM"), 0644)
+	if _, err := OpenMapped(short); err == nil {
+		t.Error("OpenMapped accepted a truncated file")
+	}
+}
@@ -0,0 +1,163 @@
+package ntsm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Material is the subset of a Wavefront MTL material used to seed
+// particle defaults
+type Material struct {
+	Name       string
+	Diffuse    [3]float32 // Kd
+	Dissolve   float32    // d, or 1 - Tr; 1 is opaque
+	DiffuseMap string     // map_Kd, relative to the MTL file
+}
+
+// Color returns the diffuse color with Dissolve as alpha
+func (m Material) Color() [4]float32 {
+	return [4]float32{m.Diffuse[0], m.Diffuse[1], m.Diffuse[2], m.Dissolve}
+}
+
+// ReadMTL parses the materials in an MTL file. Statements other than
+// newmtl, Kd, d, Tr and map_Kd are ignored
+func ReadMTL(r io.Reader) ([]Material, error) {
+	var (
+		materials []Material
+		cur       *Material
+	)
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if fields[0] == "newmtl" {
+			materials = append(materials, Material{
+				Name:     strings.Join(fields[1:], " "),
+				Diffuse:  [3]float32{1, 1, 1},
+				Dissolve: 1,
+			})
+			cur = &materials[len(materials)-1]
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+
+		var err error
+		switch fields[0] {
+		case "Kd":
+			if len(fields) < 4 {
+				err = errors.New("Kd needs 3 values")
+				break
+			}
+			for i := range cur.Diffuse {
+				if cur.Diffuse[i], err = parseMTLFloat(fields[1+i]); err != nil {
+					break
+				}
+			}
+		case "d", "Tr":
+			if len(fields) < 2 {
+				err = fmt.Errorf("%s needs a value", fields[0])
+				break
+			}
+			var v float32
+			if v, err = parseMTLFloat(fields[len(fields)-1]); err == nil {
+				if fields[0] == "Tr" {
+					v = 1 - v
+				}
+				cur.Dissolve = v
+			}
+		case "map_Kd":
+			cur.DiffuseMap = mtlMapFile(fields[1:])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ntsm: mtl line %d: %w", line, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("ntsm: reading mtl: %w", err)
+	}
+	return materials, nil
+}
+
+func parseMTLFloat(s string) (float32, error) {
+	v, err := strconv.ParseFloat(s, 32)
+	return float32(v), err
+}
+
+// mtlMapFile returns the file name of a map statement, skipping options
+// such as -s 1 1 1 or -clamp on. Names may contain spaces
+func mtlMapFile(args []string) string {
+	i := 0
+	for i < len(args) && strings.HasPrefix(args[i], "-") {
+		i++
+		for i < len(args) {
+			if _, err := strconv.ParseFloat(args[i], 64); err != nil && args[i] != "on" && args[i] != "off" {
+				break
+			}
+			i++
+		}
+	}
+	return strings.Join(args[i:], " ")
+}
+
+// MaterialTextures reads the diffuse maps of materials from dir, returning
+// one texture per distinct file and, for each material, the index of its
+// texture or -1 if it has none. Only PNG and JPEG maps are embedded, and
+// maps leading out of dir are an error
+func MaterialTextures(materials []Material, dir string) ([]Texture, []int32, error) {
+	var (
+		textures []Texture
+		indices  = make([]int32, len(materials))
+		seen     = map[string]int32{}
+	)
+	for i, m := range materials {
+		indices[i] = -1
+		if m.DiffuseMap == "" {
+			continue
+		}
+		if idx, ok := seen[m.DiffuseMap]; ok {
+			indices[i] = idx
+			continue
+		}
+
+		var mimeType string
+		switch strings.ToLower(filepath.Ext(m.DiffuseMap)) {
+		case ".png":
+			mimeType = "image/png"
+		case ".jpg", ".jpeg":
+			mimeType = "image/jpeg"
+		default:
+			continue
+		}
+
+		// Read through os.DirFS so a map such as "../../secret.png" can't
+		// reach outside dir
+		if !fs.ValidPath(m.DiffuseMap) {
+			return nil, nil, fmt.Errorf("ntsm: material %q: map %q is outside the material directory", m.Name, m.DiffuseMap)
+		}
+		data, err := fs.ReadFile(os.DirFS(dir), m.DiffuseMap)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ntsm: material %q: %w", m.Name, err)
+		}
+		idx := int32(len(textures))
+		textures = append(textures, Texture{
+			Name:     filepath.Base(m.DiffuseMap),
+			MimeType: mimeType,
+			Data:     data,
+		})
+		seen[m.DiffuseMap] = idx
+		indices[i] = idx
+	}
+	return textures, indices, nil
+}
@@ -0,0 +1,39 @@
+package ntsm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMaterialTextures(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "sword")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "blade.png"), []byte("\x89PNG blade"), 0644)
+	os.WriteFile(filepath.Join(root, "secret.png"), []byte("\x89PNG not yours"), 0644)
+
+	materials, err := ReadMTL(strings.NewReader("newmtl blade\nKd 1 1 1\nmap_Kd -s 1 1 1 blade.png\nnewmtl hilt\nKd 0.5 0.5 0.5\nnewmtl again\nmap_Kd blade.png\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	textures, indices, err := MaterialTextures(materials, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(textures) != 1 || textures[0].Name != "blade.png" || textures[0].MimeType != "image/png" || string(textures[0].Data) != "\x89PNG blade" {
+		t.Errorf("textures = %+v", textures)
+	}
+	if len(indices) != 3 || indices[0] != 0 || indices[1] != -1 || indices[2] != 0 {
+		t.Errorf("indices = %v, want [0 -1 0]", indices)
+	}
+
+	for _, m := range []string{"../secret.png", "/etc/secret.png", "sub/../../secret.png"} {
+		if _, _, err := MaterialTextures([]Material{{Name: "evil", DiffuseMap: m}}, dir); err == nil {
+			t.Errorf("map_Kd %q outside the material directory was embedded", m)
+		}
+	}
+}
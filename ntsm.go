@@ -1,31 +1,147 @@
 package ntsm
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
+	"iter"
+	"math"
+	"slices"
+	"strings"
+	"unicode/utf8"
 )
 
 const (
 	Magic      = "NTSM"
-	Version    = 1
+	Version    = 4 // Newest format version; Encode writes the lowest version that can hold its emitters
 	HeaderSize = 192
+
+	// Range of versions Decode understands
+	MinVersion = 1
+	MaxVersion = 4
+)
+
+// Flags is the header bitfield
+type Flags uint8
+
+const (
+	FlagHasParticles  Flags = 1 << 0 // Particle data is present
+	FlagGLBCompressed Flags = 1 << 1 // GLB region is DEFLATE-compressed
+	FlagMultiMesh     Flags = 1 << 4 // A mesh table lists several GLBs
+	FlagHasThumbnail  Flags = 1 << 5 // A PNG preview is embedded
+	FlagHasMeta       Flags = 1 << 6 // A key/value metadata section is present
+)
+
+// flagNames names each bit by position; bits without a flag are empty
+var flagNames = []string{"has_particles", "glb_compressed", "", "", "multi_mesh", "has_thumbnail", "has_meta"}
+
+// ErrDraftFlags is returned for a header that sets glb_compressed without
+// an uncompressed size, as a file following the draft spec, where bit 1
+// meant use_world_space, would
+var ErrDraftFlags = errors.New("ntsm: flag set without its section")
+
+// Has reports whether every bit in bit is set
+func (f Flags) Has(bit Flags) bool {
+	return f&bit == bit
+}
+
+// String lists the set bits by name, e.g. "has_particles|glb_compressed"
+func (f Flags) String() string {
+	if f == 0 {
+		return "none"
+	}
+	var names []string
+	for i, name := range flagNames {
+		if name != "" && f&(1<<i) != 0 {
+			names = append(names, name)
+			f &^= 1 << i
+		}
+	}
+	if f != 0 {
+		names = append(names, fmt.Sprintf("%#02x", uint8(f)))
+	}
+	return strings.Join(names, "|")
+}
+
+func (f *Flags) set(bit Flags, on bool) {
+	if on {
+		*f |= bit
+	} else {
+		*f &^= bit
+	}
+}
+
+// ByteOrder selects the byte order of every multi-byte field after the
+// magic. It is stored as a single byte so it can be read before the rest
+// of the header
+type ByteOrder uint8
+
+const (
+	LittleEndian ByteOrder = iota // Default, and the order of files predating the field
+	BigEndian
+)
+
+// byteOrderOffset is the offset of Header.ByteOrder
+const byteOrderOffset = 137
+
+// String returns "little-endian" or "big-endian"
+func (o ByteOrder) String() string {
+	switch o {
+	case LittleEndian:
+		return "little-endian"
+	case BigEndian:
+		return "big-endian"
+	}
+	return fmt.Sprintf("ByteOrder(%d)", uint8(o))
+}
+
+func (o ByteOrder) valid() bool {
+	return o == LittleEndian || o == BigEndian
+}
+
+// binary returns the encoding/binary order for o
+func (o ByteOrder) binary() binary.ByteOrder {
+	if o == BigEndian {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+const (
+	textureNameSize = 64
+	textureMimeSize = 32
 )
 
+// Header represents the binary header of the NTSM file format
 type Header struct {
-	Magic          [4]byte
-	Version        uint32
-	Name           [128]byte
-	Flags          uint8
-	_              [3]byte // Padding
-	GLBOffset      uint32
-	GLBSize        uint32
-	ParticleOffset uint32
-	ParticleSize   uint32
-	TextureCount   uint32
-	TextureOffset  uint32
-	_              [28]byte // Padding
+	Magic           [4]byte // "NTSM"
+	Version         uint32  // Format version (1 to 4)
+	Name            [128]byte
+	Flags           Flags     // Bitfield: bit 0 = has_particles, bit 1 = glb_compressed, bit 4 = multi_mesh, bit 5 = has_thumbnail, bit 6 = has_meta
+	ByteOrder       ByteOrder // Order of every multi-byte field and section
+	_               [2]byte   // Padding
+	GLBOffset       uint32    // Offset to GLB data
+	GLBSize         uint32    // Size of GLB data
+	ParticleOffset  uint32    // Offset to particle data
+	ParticleSize    uint32    // Size of particle data
+	TextureCount    uint32    // Number of embedded textures
+	TextureOffset   uint32    // Offset to texture table
+	GLBRawSize      uint32    // Uncompressed size of GLB data when glb_compressed is set
+	Checksum        uint32    // CRC32 of everything after the header, 0 = none
+	MeshTableOffset uint32    // Offset to the mesh table when multi_mesh is set
+	ThumbnailOffset uint32    // Offset to the PNG thumbnail when has_thumbnail is set
+	ThumbnailSize   uint32    // Size of the PNG thumbnail
+	MetaOffset      uint32    // Offset to the metadata section when has_meta is set
+	MetaSize        uint32    // Size of the metadata section
 }
 
+// ParticleEmitter represents a single particle system configuration
 type ParticleEmitter struct {
 	Position         [3]float32
 	Direction        [3]float32
@@ -40,33 +156,1426 @@ type ParticleEmitter struct {
 	VelocityMax      [3]float32
 	Gravity          float32
 	TextureIndex     int32
-	BlendMode        uint8
+	BlendMode        BlendMode
 	Loop             uint8
-	_                [2]byte
+	Space            uint8      // SpaceLocal or SpaceWorld
+	BurstCount       uint16     // Particles spawned at once by a non-looping emitter; 0 uses EmissionRate
+	Easing           Easing     // Curve from start to end size and color over a particle's life
+	GroupID          uint16     // Emitters sharing a GroupID form one effect; 0 is the default group
+	GravityVec       [3]float32 // Acceleration in any direction, e.g. for wind; replaces Gravity when non-zero
+	AtlasRect        [4]float32 // Texture region sampled, (u0, v0, u1, v1); zero means the whole texture. Version 2 on
+	Seed             uint32     // Seed for the emitter's random jitter, for reproducible playback; 0 means unseeded. Version 3 on
+	FPS              float32    // Flipbook rate in frames per second; 0 spreads the frames over a particle's lifetime. Version 4 on
+	FrameCount       uint8      // Flipbook frames, the texture table entries from TextureIndex on; 0 or 1 is a still texture. Version 4 on
+	_                [3]byte    // Padding
+}
+
+// Frames returns the number of textures e's particles cycle through, from
+// TextureIndex on: FrameCount, or 1 for a still texture
+func (e ParticleEmitter) Frames() int {
+	return max(int(e.FrameCount), 1)
+}
+
+// UVRect returns the region of e's texture its particles sample as
+// (u0, v0, u1, v1): AtlasRect, or the whole texture [0, 0, 1, 1] when it is
+// zero, as it is for every emitter in a version 1 file
+func (e ParticleEmitter) UVRect() [4]float32 {
+	if e.AtlasRect != ([4]float32{}) {
+		return e.AtlasRect
+	}
+	return [4]float32{0, 0, 1, 1}
+}
+
+// Acceleration returns the constant acceleration on e's particles: GravityVec
+// when it is non-zero, otherwise Gravity along Y. Files from before
+// GravityVec have zeros in its place, so they keep their scalar gravity
+func (e ParticleEmitter) Acceleration() [3]float32 {
+	if e.GravityVec != ([3]float32{}) {
+		return e.GravityVec
+	}
+	return [3]float32{0, e.Gravity, 0}
+}
+
+// Coordinate spaces for an emitter's Position and Direction
+const (
+	SpaceLocal uint8 = iota // Relative to the model, moving with it
+	SpaceWorld              // Absolute, ignoring the model's transform
+)
+
+// GroupEmitters groups emitters by GroupID, keeping their order within each
+// group, so an effect made of several emitters can be spawned together. It
+// returns nil if there are no emitters
+func GroupEmitters(emitters []ParticleEmitter) map[uint16][]ParticleEmitter {
+	if len(emitters) == 0 {
+		return nil
+	}
+	groups := make(map[uint16][]ParticleEmitter)
+	for _, e := range emitters {
+		groups[e.GroupID] = append(groups[e.GroupID], e)
+	}
+	return groups
+}
+
+// Each version's emitter record is the previous one with fields appended,
+// so older records decode as a prefix with the newer fields left zero
+var (
+	// EmitterSizeV4 is the size of a version 4 emitter record, 156 bytes
+	EmitterSizeV4 = binary.Size(ParticleEmitter{})
+
+	// EmitterSizeV3 is the size of a version 3 emitter record, 148 bytes: a
+	// version 4 record without FPS, FrameCount and their padding
+	EmitterSizeV3 = EmitterSizeV4 - 8
+
+	// EmitterSizeV2 is the size of a version 2 emitter record, 144 bytes: a
+	// version 3 record without Seed
+	EmitterSizeV2 = EmitterSizeV3 - binary.Size(ParticleEmitter{}.Seed)
+
+	// EmitterSize is the size of a version 1 emitter record, 128 bytes: a
+	// version 2 record without AtlasRect
+	EmitterSize = EmitterSizeV2 - binary.Size(ParticleEmitter{}.AtlasRect)
+)
+
+// emitterSize returns the size of an emitter record in a version v file
+func emitterSize(v uint32) int {
+	switch {
+	case v >= 4:
+		return EmitterSizeV4
+	case v == 3:
+		return EmitterSizeV3
+	case v == 2:
+		return EmitterSizeV2
+	}
+	return EmitterSize
+}
+
+// emitterVersion returns the oldest version that can hold emitters: 4 if
+// any is a flipbook, 3 if any has a Seed, 2 if any has an AtlasRect,
+// otherwise 1
+func emitterVersion(emitters []ParticleEmitter) uint32 {
+	v := uint32(1)
+	for i := range emitters {
+		e := &emitters[i]
+		switch {
+		case e.FrameCount != 0 || e.FPS != 0:
+			return 4
+		case e.Seed != 0:
+			v = max(v, 3)
+		case e.AtlasRect != ([4]float32{}):
+			v = max(v, 2)
+		}
+	}
+	return v
+}
+
+// EncodedParticleSize returns the size of the particle block Encode writes
+// for emitters
+func EncodedParticleSize(emitters []ParticleEmitter) int {
+	return len(emitters) * emitterSize(emitterVersion(emitters))
+}
+
+// ErrBadMagic is returned when the input doesn't start with the NTSM magic,
+// i.e. it is not an NTSM file at all
+var ErrBadMagic = errors.New("ntsm: bad magic")
+
+// ErrUnsupportedVersion is returned for files whose version is outside
+// [Min, Max]
+type ErrUnsupportedVersion struct {
+	Got, Min, Max uint32
+}
+
+func (e *ErrUnsupportedVersion) Error() string {
+	if e.Got > e.Max {
+		return fmt.Sprintf("ntsm: version %d is newer than supported versions %d-%d", e.Got, e.Min, e.Max)
+	}
+	return fmt.Sprintf("ntsm: unsupported version %d, want %d-%d", e.Got, e.Min, e.Max)
+}
+
+// Is reports whether target is also an *ErrUnsupportedVersion, so
+// errors.Is(err, &ErrUnsupportedVersion{}) matches any version
+func (e *ErrUnsupportedVersion) Is(target error) bool {
+	_, ok := target.(*ErrUnsupportedVersion)
+	return ok
+}
+
+// ErrTruncated is returned when the input ends inside a section or the
+// header. io.ErrUnexpectedEOF is wrapped alongside it
+var ErrTruncated = errors.New("ntsm: truncated file")
+
+// ErrBadParticleSize is returned when the particle block size isn't a
+// whole number of emitters
+var ErrBadParticleSize = errors.New("ntsm: bad particle size")
+
+// ErrTooLarge is returned when a section exceeds a limit set in
+// DecodeOptions
+var ErrTooLarge = errors.New("ntsm: section too large")
+
+// ErrChecksumMismatch is returned when the payload doesn't match the
+// header's checksum
+var ErrChecksumMismatch = errors.New("ntsm: checksum mismatch")
+
+// ErrInvalidGLB is returned when the GLB region isn't a well-formed GLB
+var ErrInvalidGLB = errors.New("ntsm: invalid GLB")
+
+// ErrTrailingData is reported by Verify for bytes after the last section,
+// left by a newer format version or by corruption. The rest of the file
+// may still be usable, so callers may treat it as a warning
+var ErrTrailingData = errors.New("ntsm: trailing data")
+
+// BlendMode selects how particles are composited
+type BlendMode uint8
+
+const (
+	BlendAdditive BlendMode = iota
+	BlendAlpha
+	BlendMultiply
+	BlendOpaque
+)
+
+var blendModeNames = []string{"additive", "alpha", "multiply", "opaque"}
+
+// String returns the lowercase name of the blend mode
+func (m BlendMode) String() string {
+	if m.valid() {
+		return blendModeNames[m]
+	}
+	return fmt.Sprintf("BlendMode(%d)", uint8(m))
+}
+
+// ParseBlendMode parses a blend mode name as returned by String
+func ParseBlendMode(s string) (BlendMode, error) {
+	for i, name := range blendModeNames {
+		if name == s {
+			return BlendMode(i), nil
+		}
+	}
+	return 0, fmt.Errorf("ntsm: unknown blend mode %q", s)
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (m BlendMode) MarshalText() ([]byte, error) {
+	if !m.valid() {
+		return nil, fmt.Errorf("ntsm: unknown blend mode %d", uint8(m))
+	}
+	return []byte(blendModeNames[m]), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (m *BlendMode) UnmarshalText(text []byte) error {
+	v, err := ParseBlendMode(string(text))
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+func (m BlendMode) valid() bool {
+	return int(m) < len(blendModeNames)
+}
+
+// Easing selects how size and color move from their start to their end
+// values over a particle's life
+type Easing uint8
+
+const (
+	EaseLinear Easing = iota
+	EaseIn            // Quadratic, slow at first
+	EaseOut           // Quadratic, slow at the end
+	EaseInOut         // Quadratic, slow at both ends
+)
+
+var easingNames = []string{"linear", "easeIn", "easeOut", "easeInOut"}
+
+// String returns the name of the easing
+func (e Easing) String() string {
+	if e.valid() {
+		return easingNames[e]
+	}
+	return fmt.Sprintf("Easing(%d)", uint8(e))
+}
+
+// ParseEasing parses an easing name as returned by String
+func ParseEasing(s string) (Easing, error) {
+	for i, name := range easingNames {
+		if name == s {
+			return Easing(i), nil
+		}
+	}
+	return 0, fmt.Errorf("ntsm: unknown easing %q", s)
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (e Easing) MarshalText() ([]byte, error) {
+	if !e.valid() {
+		return nil, fmt.Errorf("ntsm: unknown easing %d", uint8(e))
+	}
+	return []byte(easingNames[e]), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (e *Easing) UnmarshalText(text []byte) error {
+	v, err := ParseEasing(string(text))
+	if err != nil {
+		return err
+	}
+	*e = v
+	return nil
+}
+
+// Apply maps t, the fraction of a particle's life elapsed in [0, 1], to the
+// fraction of the way from start to end values. Unknown easings are linear
+func (e Easing) Apply(t float32) float32 {
+	t = min(max(t, 0), 1)
+	switch e {
+	case EaseIn:
+		return t * t
+	case EaseOut:
+		return 1 - (1-t)*(1-t)
+	case EaseInOut:
+		if t < 0.5 {
+			return 2 * t * t
+		}
+		return 1 - 2*(1-t)*(1-t)
+	}
+	return t
+}
+
+func (e Easing) valid() bool {
+	return int(e) < len(easingNames)
+}
+
+// TextureEntry is a single row of the texture table
+type TextureEntry struct {
+	Name     [textureNameSize]byte // Null-padded texture name
+	MimeType [textureMimeSize]byte // Null-padded MIME type, e.g. "image/png"
+	Size     uint32                // Size of texture data
+	Offset   uint32                // Offset to texture data
+}
+
+// Texture is an embedded texture and its metadata
+type Texture struct {
+	Name     string
+	MimeType string
+	Data     []byte
+}
+
+// HasParticles reports whether the has_particles flag is set
+func (h *Header) HasParticles() bool { return h.Flags.Has(FlagHasParticles) }
+
+// SetParticles sets or clears the has_particles flag
+func (h *Header) SetParticles(on bool) { h.Flags.set(FlagHasParticles, on) }
+
+// IsCompressed reports whether the glb_compressed flag is set
+func (h *Header) IsCompressed() bool { return h.Flags.Has(FlagGLBCompressed) }
+
+// SetCompressed sets or clears the glb_compressed flag
+func (h *Header) SetCompressed(on bool) { h.Flags.set(FlagGLBCompressed, on) }
+
+// IsMultiMesh reports whether the multi_mesh flag is set
+func (h *Header) IsMultiMesh() bool { return h.Flags.Has(FlagMultiMesh) }
+
+// SetMultiMesh sets or clears the multi_mesh flag
+func (h *Header) SetMultiMesh(on bool) { h.Flags.set(FlagMultiMesh, on) }
+
+// HasThumbnail reports whether a thumbnail is embedded
+func (h *Header) HasThumbnail() bool { return h.Flags.Has(FlagHasThumbnail) }
+
+// HasMeta reports whether a metadata section is present
+func (h *Header) HasMeta() bool { return h.Flags.Has(FlagHasMeta) }
+
+// NameString returns the item name up to its first null byte
+func (h *Header) NameString() string {
+	return cString(h.Name[:])
+}
+
+// cString returns b up to its first null byte
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// SetName sets the item name. Names longer than the field's 127 bytes are
+// truncated on a rune boundary, so the stored name stays valid UTF-8
+func (h *Header) SetName(s string) {
+	putCString(h.Name[:], s)
 }
 
+// putCString copies s into dst, truncating on a rune boundary so at least
+// one null byte remains
+func putCString(dst []byte, s string) {
+	if len(s) >= len(dst) {
+		n := len(dst) - 1
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		s = s[:n]
+	}
+	n := copy(dst, s)
+	clear(dst[n:])
+}
+
+// Validate checks the header for consistency. When fileSize is positive the
+// GLB and particle regions must also lie within the file
+func (h *Header) Validate(fileSize int64) error {
+	if string(h.Magic[:]) != Magic {
+		return fmt.Errorf("%w %q", ErrBadMagic, h.Magic[:])
+	}
+	if err := h.RequireVersion(); err != nil {
+		return err
+	}
+	if !h.ByteOrder.valid() {
+		return fmt.Errorf("ntsm: unknown byte order %d", uint8(h.ByteOrder))
+	}
+	if h.GLBOffset < HeaderSize {
+		return fmt.Errorf("ntsm: GLB offset %d overlaps the %d-byte header", h.GLBOffset, HeaderSize)
+	}
+	if h.IsCompressed() && h.GLBSize > 0 && h.GLBRawSize == 0 {
+		return fmt.Errorf("%w: %s is set but GLBRawSize is 0 (in the draft spec this bit was use_world_space)", ErrDraftFlags, FlagGLBCompressed)
+	}
+	glbEnd := int64(h.GLBOffset) + int64(h.GLBSize)
+	if fileSize > 0 && glbEnd > fileSize {
+		return fmt.Errorf("%w: GLB region [%d, %d) exceeds file size %d", ErrTruncated, h.GLBOffset, glbEnd, fileSize)
+	}
+
+	if h.HasParticles() {
+		if h.ParticleSize == 0 {
+			return fmt.Errorf("%w: has_particles flag set but size is 0", ErrBadParticleSize)
+		}
+		if size := emitterSize(h.Version); h.ParticleSize%uint32(size) != 0 {
+			return fmt.Errorf("%w: %d is not a multiple of %d", ErrBadParticleSize, h.ParticleSize, size)
+		}
+		if int64(h.ParticleOffset) < glbEnd {
+			return fmt.Errorf("ntsm: particle offset %d overlaps the GLB region ending at %d", h.ParticleOffset, glbEnd)
+		}
+		particleEnd := int64(h.ParticleOffset) + int64(h.ParticleSize)
+		if fileSize > 0 && particleEnd > fileSize {
+			return fmt.Errorf("%w: particle region [%d, %d) exceeds file size %d", ErrTruncated, h.ParticleOffset, particleEnd, fileSize)
+		}
+	}
+
+	if h.IsMultiMesh() && h.MeshTableOffset < HeaderSize {
+		return fmt.Errorf("ntsm: mesh table offset %d overlaps the %d-byte header", h.MeshTableOffset, HeaderSize)
+	}
+
+	if h.HasThumbnail() {
+		thumbEnd := int64(h.ThumbnailOffset) + int64(h.ThumbnailSize)
+		if h.ThumbnailSize == 0 || int64(h.ThumbnailOffset) < h.payloadEnd() {
+			return fmt.Errorf("ntsm: invalid thumbnail region [%d, %d)", h.ThumbnailOffset, thumbEnd)
+		}
+		if fileSize > 0 && thumbEnd > fileSize {
+			return fmt.Errorf("%w: thumbnail region [%d, %d) exceeds file size %d", ErrTruncated, h.ThumbnailOffset, thumbEnd, fileSize)
+		}
+	}
+
+	if h.HasMeta() {
+		metaEnd := int64(h.MetaOffset) + int64(h.MetaSize)
+		if h.MetaSize == 0 || int64(h.MetaOffset) < h.payloadEnd() {
+			return fmt.Errorf("ntsm: invalid metadata region [%d, %d)", h.MetaOffset, metaEnd)
+		}
+		if fileSize > 0 && metaEnd > fileSize {
+			return fmt.Errorf("%w: metadata region [%d, %d) exceeds file size %d", ErrTruncated, h.MetaOffset, metaEnd, fileSize)
+		}
+	}
+
+	if h.TextureCount > 0 {
+		if int64(h.TextureOffset) < h.payloadEnd() {
+			return fmt.Errorf("ntsm: texture table offset %d overlaps preceding sections", h.TextureOffset)
+		}
+		tableEnd := int64(h.TextureOffset) + int64(h.TextureCount)*textureEntrySize
+		if tableEnd > math.MaxUint32 {
+			return fmt.Errorf("ntsm: texture count %d overflows the texture table", h.TextureCount)
+		}
+		if fileSize > 0 && tableEnd > fileSize {
+			return fmt.Errorf("%w: texture table [%d, %d) exceeds file size %d", ErrTruncated, h.TextureOffset, tableEnd, fileSize)
+		}
+	}
+
+	return nil
+}
+
+// RequireVersion returns an *ErrUnsupportedVersion if this package can't
+// read the file's version
+func (h *Header) RequireVersion() error {
+	if h.Version < MinVersion || h.Version > MaxVersion {
+		return &ErrUnsupportedVersion{Got: h.Version, Min: MinVersion, Max: MaxVersion}
+	}
+	return nil
+}
+
+// payloadEnd returns the end of the GLB and particle regions
+func (h *Header) payloadEnd() int64 {
+	end := int64(h.GLBOffset) + int64(h.GLBSize)
+	if h.HasParticles() {
+		end = max(end, int64(h.ParticleOffset)+int64(h.ParticleSize))
+	}
+	return end
+}
+
+// TrailingBytes returns how many bytes of a fileSize-byte file lie past
+// the last region the header describes. Texture data and meshes after the
+// first are described by their tables rather than the header, so a file
+// holding them without a thumbnail after them reports them here; Verify
+// reads the tables and accounts for them
+func (h *Header) TrailingBytes(fileSize int64) int64 {
+	return max(0, fileSize-h.knownEnd())
+}
+
+// knownEnd returns the end of the furthest region the header describes
+func (h *Header) knownEnd() int64 {
+	end := max(int64(HeaderSize), h.payloadEnd())
+	if h.IsMultiMesh() {
+		end = max(end, int64(h.MeshTableOffset)+4)
+	}
+	if h.TextureCount > 0 {
+		end = max(end, int64(h.TextureOffset)+int64(h.TextureCount)*textureEntrySize)
+	}
+	if h.HasMeta() {
+		end = max(end, int64(h.MetaOffset)+int64(h.MetaSize))
+	}
+	if h.HasThumbnail() {
+		end = max(end, int64(h.ThumbnailOffset)+int64(h.ThumbnailSize))
+	}
+	return end
+}
+
+var textureEntrySize = int64(binary.Size(TextureEntry{}))
+
+// Validate checks the emitter for values that would render as garbage:
+// non-finite floats, negative rates, lifetimes or sizes, a spread angle
+// outside [0, 2π], a TextureIndex that is neither -1 (the default spark)
+// nor an index into a texture table of textureCount entries, and flipbook
+// frames running past the end of the table
+func (e *ParticleEmitter) Validate(textureCount int) error {
+	if err := e.validate(textureCount); err != nil {
+		return fmt.Errorf("ntsm: %w", err)
+	}
+	return nil
+}
+
+func (e *ParticleEmitter) validate(textureCount int) error {
+	floats := []float32{e.SpreadAngle, e.EmissionRate, e.ParticleLifetime, e.StartSize, e.EndSize, e.Gravity, e.FPS}
+	floats = append(floats, e.Position[:]...)
+	floats = append(floats, e.Direction[:]...)
+	floats = append(floats, e.StartColor[:]...)
+	floats = append(floats, e.EndColor[:]...)
+	floats = append(floats, e.VelocityMin[:]...)
+	floats = append(floats, e.VelocityMax[:]...)
+	floats = append(floats, e.GravityVec[:]...)
+	floats = append(floats, e.AtlasRect[:]...)
+	for _, f := range floats {
+		if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+			return errors.New("non-finite value")
+		}
+	}
+
+	switch {
+	case e.EmissionRate < 0:
+		return fmt.Errorf("negative emission rate %g", e.EmissionRate)
+	case e.ParticleLifetime < 0:
+		return fmt.Errorf("negative particle lifetime %g", e.ParticleLifetime)
+	case e.StartSize < 0 || e.EndSize < 0:
+		return fmt.Errorf("negative particle size %g → %g", e.StartSize, e.EndSize)
+	case e.SpreadAngle < 0 || e.SpreadAngle > 2*math.Pi:
+		return fmt.Errorf("spread angle %g outside [0, 2π]", e.SpreadAngle)
+	case e.TextureIndex < -1 || int64(e.TextureIndex) >= int64(textureCount):
+		return fmt.Errorf("texture index %d out of range for %d textures", e.TextureIndex, textureCount)
+	case !e.BlendMode.valid():
+		return fmt.Errorf("unknown blend mode %d", uint8(e.BlendMode))
+	case e.Space > SpaceWorld:
+		return fmt.Errorf("unknown emitter space %d", e.Space)
+	case !e.Easing.valid():
+		return fmt.Errorf("unknown easing %d", uint8(e.Easing))
+	case e.BurstCount > 0 && e.Loop != 0:
+		return fmt.Errorf("burst count %d on a looping emitter", e.BurstCount)
+	case e.FPS < 0:
+		return fmt.Errorf("negative flipbook rate %g", e.FPS)
+	case e.FrameCount > 1 && (e.TextureIndex < 0 || int64(e.TextureIndex)+int64(e.FrameCount) > int64(textureCount)):
+		return fmt.Errorf("%d flipbook frames from texture index %d out of range for %d textures", e.FrameCount, e.TextureIndex, textureCount)
+	case e.AtlasRect != [4]float32{} && !validAtlasRect(e.AtlasRect):
+		return fmt.Errorf("atlas rect %v is empty or outside [0, 1]", e.AtlasRect)
+	}
+	return nil
+}
+
+// validAtlasRect reports whether r lies within [0, 1] with u0 < u1 and
+// v0 < v1
+func validAtlasRect(r [4]float32) bool {
+	for _, f := range r {
+		if f < 0 || f > 1 {
+			return false
+		}
+	}
+	return r[0] < r[2] && r[1] < r[3]
+}
+
+// validateEmitters validates each emitter, joining the failures with their
+// indices
+func validateEmitters(emitters []ParticleEmitter, textureCount int) error {
+	var errs []error
+	for i := range emitters {
+		if err := emitters[i].validate(textureCount); err != nil {
+			errs = append(errs, fmt.Errorf("ntsm: emitter %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DecodeOptions controls optional decoding behavior
+type DecodeOptions struct {
+	// VerifyChecksum checks the payload against the header checksum and
+	// returns ErrChecksumMismatch on failure. Files with a zero checksum
+	// carry none and are not checked
+	VerifyChecksum bool
+
+	// SkipGLB leaves the GLB (and any mesh table) unread, returning a nil
+	// GLB. The region is seeked past when the reader is an io.Seeker and
+	// the checksum isn't being verified, and discarded otherwise
+	SkipGLB bool
+
+	// SkipParticles leaves the particle block unread and undecoded,
+	// returning nil emitters. It is passed over like a skipped GLB
+	SkipParticles bool
+
+	// Limits on what decoding may allocate, checked against the header and
+	// tables before each section is read so untrusted input fails with
+	// ErrTooLarge instead. MaxGLBSize counts the GLB once decompressed, and
+	// every level of detail read from a multi-mesh file; MaxTextureBytes
+	// counts the data of all textures. 0 means no limit
+	MaxGLBSize       int64
+	MaxParticleBytes int64
+	MaxTextureBytes  int64
+}
+
+// checkLimit returns ErrTooLarge if size exceeds limit, unless limit is 0
+func checkLimit(what string, size, limit int64) error {
+	if limit > 0 && size > limit {
+		return fmt.Errorf("%w: %s is %d bytes, more than the limit of %d", ErrTooLarge, what, size, limit)
+	}
+	return nil
+}
+
+// payload holds the decoded or to-be-encoded sections of a file
+type payload struct {
+	glb      []byte
+	meshes   []GLBEntry
+	emitters []ParticleEmitter
+	textures []Texture
+	meta     map[string]string
+
+	thumbnail []byte
+}
+
+// Sections a decode should return; the GLB and emitters always are
+const (
+	wantTextures = 1 << iota
+	wantMeshes
+	wantThumbnail
+	wantMeta
+)
+
 // Decode reads an NTSM file and returns header, GLB bytes, and emitters
 func Decode(r io.Reader) (*Header, []byte, []ParticleEmitter, error) {
+	hdr, p, err := decode(r, 0, DecodeOptions{})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return hdr, p.glb, p.emitters, nil
+}
+
+// DecodeWithTextures is like Decode but also reads the embedded textures
+func DecodeWithTextures(r io.Reader) (*Header, []byte, []ParticleEmitter, []Texture, error) {
+	return DecodeWithOptions(r, DecodeOptions{})
+}
+
+// DecodeWithOptions is like DecodeWithTextures with additional options
+func DecodeWithOptions(r io.Reader, opts DecodeOptions) (*Header, []byte, []ParticleEmitter, []Texture, error) {
+	hdr, p, err := decode(r, wantTextures, opts)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return hdr, p.glb, p.emitters, p.textures, nil
+}
+
+// ReservedSize is the number of bytes between the last Header field and
+// HeaderSize, set aside for future fields. Writers zero them and readers
+// ignore them. Every byte is currently in use, so it is 0: a new field needs
+// HeaderSize raised along with a version, and still has to end before
+// GLBOffset, which is where older readers look for the payload
+var ReservedSize = HeaderSize - binary.Size(Header{})
+
+// writeHeader writes hdr followed by its zeroed padding, HeaderSize bytes
+// in all. Bytes after the name's terminator are written as zeros, so a
+// header whose name was overwritten in place encodes the same as a fresh one
+func writeHeader(w io.Writer, order binary.ByteOrder, hdr *Header) error {
+	h := *hdr
+	if i := bytes.IndexByte(h.Name[:], 0); i >= 0 {
+		clear(h.Name[i:])
+	}
+	if err := binary.Write(w, order, &h); err != nil {
+		return err
+	}
+	_, err := w.Write(make([]byte, ReservedSize))
+	return err
+}
+
+// Sniff reports whether r starts with the NTSM magic, so files can be
+// recognized by content whatever their extension. Input shorter than the
+// magic isn't NTSM rather than an error
+func Sniff(r io.ReaderAt) (bool, error) {
+	var buf [len(Magic)]byte
+	n, err := r.ReadAt(buf[:], 0)
+	if n == len(buf) {
+		return string(buf[:]) == Magic, nil
+	}
+	if err == io.EOF {
+		return false, nil
+	}
+	return false, err
+}
+
+// DecodeHeader reads and validates only the header, leaving r positioned at
+// the end of the header padding
+func DecodeHeader(r io.Reader) (*Header, error) {
+	var buf [HeaderSize]byte
+	n, err := io.ReadFull(r, buf[:])
+	// Check the magic first so non-NTSM input too short for a header
+	// isn't reported as a truncated file
+	if seen := buf[:min(n, len(Magic))]; n > 0 && string(seen) != Magic[:len(seen)] {
+		return nil, fmt.Errorf("%w %q", ErrBadMagic, seen)
+	}
+	if err != nil {
+		return nil, truncated(err)
+	}
+
 	var hdr Header
-	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+	if err := hdr.UnmarshalBinary(buf[:]); err != nil {
+		return nil, err
+	}
+	if err := hdr.Validate(0); err != nil {
+		return nil, err
+	}
+	return &hdr, nil
+}
+
+// MarshalBinary returns the header exactly as it is written to a file:
+// HeaderSize bytes, padding included, in the header's byte order. Offsets
+// and sizes are taken as they are, not derived from any payload
+func (h *Header) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(HeaderSize)
+	if err := writeHeader(&buf, h.ByteOrder.binary(), h); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a header from exactly HeaderSize bytes, in the
+// byte order they declare. Unlike DecodeHeader it doesn't validate the
+// result, so malformed headers can be inspected
+func (h *Header) UnmarshalBinary(data []byte) error {
+	if len(data) != HeaderSize {
+		return fmt.Errorf("ntsm: header is %d bytes, want %d", len(data), HeaderSize)
+	}
+	order := ByteOrder(data[byteOrderOffset]).binary()
+	return binary.Read(bytes.NewReader(data), order, h)
+}
+
+// decode reads a file front to back. Sections are located by their header
+// offsets and read in file order, whatever order they were written in, so
+// regions this version doesn't know about are passed over
+func decode(r io.Reader, want int, opts DecodeOptions) (*Header, payload, error) {
+	hdr, err := DecodeHeader(r)
+	if err != nil {
+		return nil, payload{}, err
+	}
+	p, err := decodeSections(r, hdr, want, opts)
+	if err != nil {
+		return nil, p, err
+	}
+	return hdr, p, nil
+}
+
+// decodeSections reads the sections hdr describes from r, which is
+// positioned just after the header
+func decodeSections(r io.Reader, hdr *Header, want int, opts DecodeOptions) (payload, error) {
+	var (
+		p   payload
+		err error
+	)
+
+	var crc hash.Hash32
+	if opts.VerifyChecksum && hdr.Checksum != 0 {
+		crc = crc32.NewIEEE()
+		r = io.TeeReader(r, crc)
+	}
+	sr := &seqReader{r: r, pos: HeaderSize}
+
+	// Sections are queued by offset and then read in that order; the GLB
+	// and particles always come first, as Validate checks
+	const (
+		stepGLB = iota
+		stepMeshes
+		stepParticles
+		stepTextures
+		stepMeta
+		stepThumbnail
+	)
+	type step struct {
+		offset uint32
+		kind   int
+	}
+	var queue [6]step
+	steps := queue[:0]
+	switch {
+	case opts.SkipGLB:
+		// The next section read skips over the GLB
+	case hdr.IsMultiMesh():
+		steps = append(steps, step{hdr.MeshTableOffset, stepMeshes})
+	default:
+		steps = append(steps, step{hdr.GLBOffset, stepGLB})
+	}
+	if hdr.ParticleSize > 0 && hdr.HasParticles() && !opts.SkipParticles {
+		steps = append(steps, step{hdr.ParticleOffset, stepParticles})
+	}
+	// The checksum covers every section, so read them all when verifying
+	if (want&wantTextures != 0 || crc != nil) && hdr.TextureCount > 0 {
+		steps = append(steps, step{hdr.TextureOffset, stepTextures})
+	}
+	if (want&wantMeta != 0 || crc != nil) && hdr.HasMeta() {
+		steps = append(steps, step{hdr.MetaOffset, stepMeta})
+	}
+	if (want&wantThumbnail != 0 || crc != nil) && hdr.HasThumbnail() {
+		steps = append(steps, step{hdr.ThumbnailOffset, stepThumbnail})
+	}
+	slices.SortStableFunc(steps, func(a, b step) int { return cmp.Compare(a.offset, b.offset) })
+
+	for _, st := range steps {
+		switch st.kind {
+		case stepMeshes:
+			// Every mesh is read when verifying since the checksum covers them
+			if p.meshes, err = readMeshes(sr, hdr, want&wantMeshes != 0 || crc != nil, opts.MaxGLBSize); err != nil {
+				return p, err
+			}
+			p.glb = p.meshes[0].Data
+			if want&wantMeshes == 0 {
+				p.meshes = nil
+			}
+		case stepGLB:
+			if err := checkLimit("GLB", decodedGLBSize(hdr.GLBSize, hdr.GLBRawSize, hdr.Flags), opts.MaxGLBSize); err != nil {
+				return p, err
+			}
+			if p.glb, err = readGLB(sr, hdr.GLBOffset, hdr.GLBSize, hdr.GLBRawSize, hdr.Flags); err != nil {
+				return p, err
+			}
+			if want&wantMeshes != 0 {
+				p.meshes = []GLBEntry{{Name: hdr.NameString(), Data: p.glb}}
+			}
+		case stepParticles:
+			if err := checkLimit("particle block", int64(hdr.ParticleSize), opts.MaxParticleBytes); err != nil {
+				return p, err
+			}
+			data, err := sr.section(int64(hdr.ParticleOffset), hdr.ParticleSize)
+			if err != nil {
+				return p, err
+			}
+			if p.emitters, err = decodeEmitters(data, hdr.ByteOrder, hdr.Version); err != nil {
+				return p, err
+			}
+		case stepTextures:
+			if p.textures, err = readTextures(sr, hdr, opts.MaxTextureBytes); err != nil {
+				return p, err
+			}
+		case stepMeta:
+			data, err := sr.section(int64(hdr.MetaOffset), hdr.MetaSize)
+			if err != nil {
+				return p, fmt.Errorf("ntsm: metadata: %w", err)
+			}
+			if want&wantMeta != 0 {
+				if p.meta, err = decodeMeta(data, hdr.ByteOrder); err != nil {
+					return p, err
+				}
+			}
+		case stepThumbnail:
+			if p.thumbnail, err = sr.section(int64(hdr.ThumbnailOffset), hdr.ThumbnailSize); err != nil {
+				return p, fmt.Errorf("ntsm: thumbnail: %w", err)
+			}
+		}
+	}
+	if want&wantTextures == 0 {
+		p.textures = nil
+	}
+	if want&wantThumbnail == 0 {
+		p.thumbnail = nil
+	}
+
+	if crc != nil && crc.Sum32() != hdr.Checksum {
+		// The checksum also covers sections this version doesn't know,
+		// which can only follow the known ones
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return p, err
+		}
+		if crc.Sum32() != hdr.Checksum {
+			return p, fmt.Errorf("%w: computed %08x, header has %08x", ErrChecksumMismatch, crc.Sum32(), hdr.Checksum)
+		}
+	}
+
+	return p, nil
+}
+
+// decodedGLBSize returns the larger of a GLB region's stored and decoded
+// sizes. rawSize only counts when flags mark the region compressed, since
+// otherwise it is meaningless and may hold anything
+func decodedGLBSize(size, rawSize uint32, flags Flags) int64 {
+	if flags.Has(FlagGLBCompressed) {
+		return int64(max(size, rawSize))
+	}
+	return int64(size)
+}
+
+// readGLB reads a GLB region, decompressing it when flags say so
+func readGLB(sr *seqReader, offset, size, rawSize uint32, flags Flags) ([]byte, error) {
+	data, err := sr.section(int64(offset), size)
+	if err != nil {
+		return nil, err
+	}
+	if flags.Has(FlagGLBCompressed) {
+		return decompressGLB(data, rawSize)
+	}
+	return data, nil
+}
+
+// DecodeAt reads an NTSM file of the given size from r, reading each section
+// from the offset recorded in the header
+func DecodeAt(r io.ReaderAt, size int64) (*Header, []byte, []ParticleEmitter, error) {
+	hdr, err := DecodeHeader(io.NewSectionReader(r, 0, HeaderSize))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := hdr.Validate(size); err != nil {
 		return nil, nil, nil, err
 	}
 
-	glbData := make([]byte, hdr.GLBSize)
-	if _, err := io.ReadFull(r, glbData); err != nil {
+	glbData, err := readSectionAt(r, hdr.GLBOffset, hdr.GLBSize)
+	if err != nil {
 		return nil, nil, nil, err
 	}
+	if hdr.IsCompressed() {
+		if glbData, err = decompressGLB(glbData, hdr.GLBRawSize); err != nil {
+			return nil, nil, nil, err
+		}
+	}
 
 	var emitters []ParticleEmitter
-	if hdr.ParticleSize > 0 && (hdr.Flags&0x01) != 0 {
-		count := hdr.ParticleSize / 128
-		emitters = make([]ParticleEmitter, count)
+	if hdr.ParticleSize > 0 && hdr.HasParticles() {
+		data, err := readSectionAt(r, hdr.ParticleOffset, hdr.ParticleSize)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if emitters, err = decodeEmitters(data, hdr.ByteOrder, hdr.Version); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return hdr, glbData, emitters, nil
+}
+
+// OpenGLB returns a reader over the GLB region of r without copying it. The
+// region must be uncompressed and lie within r
+func OpenGLB(r io.ReaderAt, hdr *Header) (*io.SectionReader, error) {
+	if hdr.IsCompressed() {
+		return nil, errors.New("ntsm: GLB region is compressed")
+	}
+	if hdr.GLBOffset < HeaderSize {
+		return nil, fmt.Errorf("ntsm: GLB offset %d overlaps the %d-byte header", hdr.GLBOffset, HeaderSize)
+	}
+	if hdr.GLBSize > 0 {
+		last := int64(hdr.GLBOffset) + int64(hdr.GLBSize) - 1
+		if _, err := r.ReadAt(make([]byte, 1), last); err != nil {
+			return nil, fmt.Errorf("ntsm: GLB region ends past the end of the file: %w", err)
+		}
+	}
+	return io.NewSectionReader(r, int64(hdr.GLBOffset), int64(hdr.GLBSize)), nil
+}
+
+// OpenValidatedGLB reads the GLB region of r, decompressing it if needed,
+// and checks it is a GLB before returning it: the glTF magic and version 2,
+// a total length matching the region, and a leading JSON chunk. When the
+// header has a checksum the rest of r is read to check it too, returning
+// ErrChecksumMismatch. In a multi-mesh file this is the first mesh
+func (h *Header) OpenValidatedGLB(r io.ReaderAt) ([]byte, error) {
+	if h.GLBOffset < HeaderSize {
+		return nil, fmt.Errorf("ntsm: GLB offset %d overlaps the %d-byte header", h.GLBOffset, HeaderSize)
+	}
+	// Read incrementally rather than through readSectionAt, since GLBSize
+	// hasn't been checked against the size of r
+	data, err := readSection(io.NewSectionReader(r, int64(h.GLBOffset), int64(h.GLBSize)), h.GLBSize)
+	if err != nil {
+		return nil, err
+	}
+	if h.Checksum != 0 {
+		// The checksum runs to the end of the file, wherever r says that is
+		crc := crc32.NewIEEE()
+		if _, err := io.Copy(crc, io.NewSectionReader(r, HeaderSize, math.MaxInt64-HeaderSize)); err != nil {
+			return nil, err
+		}
+		if crc.Sum32() != h.Checksum {
+			return nil, fmt.Errorf("%w: computed %08x, header has %08x", ErrChecksumMismatch, crc.Sum32(), h.Checksum)
+		}
+	}
+	if h.IsCompressed() {
+		if data, err = decompressGLB(data, h.GLBRawSize); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateGLB(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// glbJSONChunk is the chunk type of a GLB's JSON chunk, "JSON" read
+// little-endian
+const glbJSONChunk = 0x4E4F534A
+
+// validateGLB checks the 12-byte GLB header and that the first chunk is a
+// JSON chunk within the data. GLB fields are little-endian whatever the
+// file's byte order
+func validateGLB(data []byte) error {
+	if len(data) < 20 {
+		return fmt.Errorf("%w: %d bytes is too short", ErrInvalidGLB, len(data))
+	}
+	if string(data[:4]) != "glTF" {
+		return fmt.Errorf("%w: missing glTF magic", ErrInvalidGLB)
+	}
+	if v := binary.LittleEndian.Uint32(data[4:]); v != 2 {
+		return fmt.Errorf("%w: glTF version %d, want 2", ErrInvalidGLB, v)
+	}
+	if n := binary.LittleEndian.Uint32(data[8:]); int64(n) != int64(len(data)) {
+		return fmt.Errorf("%w: length field %d doesn't match the %d-byte region", ErrInvalidGLB, n, len(data))
+	}
+	chunkLen := binary.LittleEndian.Uint32(data[12:])
+	if binary.LittleEndian.Uint32(data[16:]) != glbJSONChunk {
+		return fmt.Errorf("%w: first chunk isn't JSON", ErrInvalidGLB)
+	}
+	if int64(chunkLen) > int64(len(data))-20 {
+		return fmt.Errorf("%w: JSON chunk of %d bytes runs past the end", ErrInvalidGLB, chunkLen)
+	}
+	return nil
+}
+
+// ReadThumbnail reads just the header and the embedded PNG thumbnail,
+// returning nil if the file has none
+func ReadThumbnail(r io.ReaderAt) ([]byte, error) {
+	hdr, err := DecodeHeader(io.NewSectionReader(r, 0, HeaderSize))
+	if err != nil {
+		return nil, err
+	}
+	if !hdr.HasThumbnail() {
+		return nil, nil
+	}
+	return readSection(io.NewSectionReader(r, int64(hdr.ThumbnailOffset), int64(hdr.ThumbnailSize)), hdr.ThumbnailSize)
+}
+
+// DecodeEmitterAt reads just emitter index from the file in r, whose header
+// is hdr, without decoding the rest of the particle block
+func DecodeEmitterAt(r io.ReaderAt, hdr *Header, index int) (ParticleEmitter, error) {
+	var e ParticleEmitter
+	if err := hdr.RequireVersion(); err != nil {
+		return e, err
+	}
+	count := 0
+	if hdr.HasParticles() {
+		count = int(hdr.ParticleSize) / emitterSize(hdr.Version)
+	}
+	if index < 0 || index >= count {
+		return e, fmt.Errorf("ntsm: emitter index %d out of range [0, %d)", index, count)
+	}
+
+	size := emitterSize(hdr.Version)
+	offset := int64(hdr.ParticleOffset) + int64(index)*int64(size)
+	data, err := readSection(io.NewSectionReader(r, offset, int64(size)), uint32(size))
+	if err != nil {
+		return e, fmt.Errorf("ntsm: reading emitter %d: %w", index, err)
+	}
+	// Older records leave the newer fields zero
+	rec := make([]byte, EmitterSizeV4)
+	copy(rec, data)
+	if err := binary.Read(bytes.NewReader(rec), hdr.ByteOrder.binary(), &e); err != nil {
+		return e, err
+	}
+	return e, checkEmitter(index, &e)
+}
+
+// EmitterSeq returns an iterator over the emitters in the file in r, whose
+// header is h, decoding one record at a time rather than allocating the
+// whole particle block. Iteration stops after the first error is yielded
+func (h *Header) EmitterSeq(r io.ReaderAt) iter.Seq2[ParticleEmitter, error] {
+	return func(yield func(ParticleEmitter, error) bool) {
+		if !h.HasParticles() {
+			return
+		}
+		// A newer version's records may be larger than any known here
+		if err := h.RequireVersion(); err != nil {
+			yield(ParticleEmitter{}, err)
+			return
+		}
+		br := bufio.NewReader(io.NewSectionReader(r, int64(h.ParticleOffset), int64(h.ParticleSize)))
+		// Older records fill only the start of buf, leaving the newer
+		// fields zero
+		size := emitterSize(h.Version)
+		buf := make([]byte, EmitterSizeV4)
+		for i := range int(h.ParticleSize) / size {
+			var e ParticleEmitter
+			if _, err := io.ReadFull(br, buf[:size]); err != nil {
+				yield(e, fmt.Errorf("ntsm: reading emitter %d: %w", i, truncated(err)))
+				return
+			}
+			err := binary.Read(bytes.NewReader(buf), h.ByteOrder.binary(), &e)
+			if err == nil {
+				err = checkEmitter(i, &e)
+			}
+			if !yield(e, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// encodeEmitters encodes emitters as the particle block of a version v file
+func encodeEmitters(emitters []ParticleEmitter, order ByteOrder, v uint32) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, order.binary(), emitters); err != nil {
+		return nil, err
+	}
+	data, size := buf.Bytes(), emitterSize(v)
+	if size == EmitterSizeV4 {
+		return data, nil
+	}
+	// Narrow to older records in place, dropping the newer fields
+	out := data[:0]
+	for off := 0; off < len(data); off += EmitterSizeV4 {
+		out = append(out, data[off:off+size]...)
+	}
+	return out, nil
+}
+
+// checkEmitter reports enum fields of emitter i that no version of the
+// format defines
+func checkEmitter(i int, e *ParticleEmitter) error {
+	if !e.BlendMode.valid() {
+		return fmt.Errorf("ntsm: emitter %d: unknown blend mode %d", i, uint8(e.BlendMode))
+	}
+	if !e.Easing.valid() {
+		return fmt.Errorf("ntsm: emitter %d: unknown easing %d", i, uint8(e.Easing))
+	}
+	return nil
+}
+
+// decodeEmitters decodes the particle block of a version v file
+func decodeEmitters(data []byte, order ByteOrder, v uint32) ([]ParticleEmitter, error) {
+	size := emitterSize(v)
+	if len(data)%size != 0 {
+		return nil, fmt.Errorf("%w: %d is not a multiple of %d", ErrBadParticleSize, len(data), size)
+	}
+	emitters := make([]ParticleEmitter, len(data)/size)
+	if size != EmitterSizeV4 {
+		// Widen older records, leaving the newer fields zero
+		wide := make([]byte, len(emitters)*EmitterSizeV4)
 		for i := range emitters {
-			if err := binary.Read(r, binary.LittleEndian, &emitters[i]); err != nil {
-				return nil, nil, nil, err
+			copy(wide[i*EmitterSizeV4:], data[i*size:(i+1)*size])
+		}
+		data = wide
+	}
+	if err := binary.Read(bytes.NewReader(data), order.binary(), emitters); err != nil {
+		return nil, err
+	}
+	for i := range emitters {
+		if err := checkEmitter(i, &emitters[i]); err != nil {
+			return nil, err
+		}
+	}
+	return emitters, nil
+}
+
+// readTextures reads the texture table and texture data. Texture data must
+// be stored in table order
+func readTextures(sr *seqReader, hdr *Header, limit int64) ([]Texture, error) {
+	table, err := sr.section(int64(hdr.TextureOffset), hdr.TextureCount*uint32(textureEntrySize))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]TextureEntry, hdr.TextureCount)
+	if err := binary.Read(bytes.NewReader(table), hdr.ByteOrder.binary(), entries); err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, e := range entries {
+		total += int64(e.Size)
+	}
+	if err := checkLimit("texture data", total, limit); err != nil {
+		return nil, err
+	}
+
+	textures := make([]Texture, len(entries))
+	for i, e := range entries {
+		data, err := sr.section(int64(e.Offset), e.Size)
+		if err != nil {
+			return nil, fmt.Errorf("ntsm: texture %d: %w", i, err)
+		}
+		textures[i] = Texture{
+			Name:     cString(e.Name[:]),
+			MimeType: cString(e.MimeType[:]),
+			Data:     data,
+		}
+	}
+	return textures, nil
+}
+
+// readSectionAt reads size bytes at offset. Callers must have validated the
+// region against the file size first
+func readSectionAt(r io.ReaderAt, offset, size uint32) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(io.NewSectionReader(r, int64(offset), int64(size)), data); err != nil {
+		return nil, truncated(err)
+	}
+	return data, nil
+}
+
+// seqReader tracks the file offset of a forward-only reader so sections can
+// be read by offset, discarding any gap before them
+type seqReader struct {
+	r   io.Reader
+	pos int64
+}
+
+// skip advances to offset, seeking when the reader supports it
+func (s *seqReader) skip(offset int64) error {
+	if offset == s.pos {
+		return nil
+	}
+	if seeker, ok := s.r.(io.Seeker); ok {
+		if _, err := seeker.Seek(offset-s.pos, io.SeekCurrent); err != nil {
+			return err
+		}
+	} else if _, err := io.CopyN(io.Discard, s.r, offset-s.pos); err != nil {
+		return truncated(err)
+	}
+	s.pos = offset
+	return nil
+}
+
+// section reads size bytes at offset, which must not precede the current
+// position
+func (s *seqReader) section(offset int64, size uint32) ([]byte, error) {
+	if offset < s.pos {
+		return nil, fmt.Errorf("ntsm: section at offset %d precedes current position %d", offset, s.pos)
+	}
+	if err := s.skip(offset); err != nil {
+		return nil, err
+	}
+
+	data, err := readSection(s.r, size)
+	if err != nil {
+		return nil, err
+	}
+	s.pos += int64(size)
+	return data, nil
+}
+
+// truncated marks an EOF from reading a section as ErrTruncated, keeping
+// io.ErrUnexpectedEOF in the chain
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: %w", ErrTruncated, io.ErrUnexpectedEOF)
+	}
+	return err
+}
+
+// readSection reads exactly size bytes, growing the buffer as data arrives
+// so a corrupt size can't force a huge up-front allocation
+func readSection(r io.Reader, size uint32) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(size)); err != nil {
+		return nil, truncated(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// EncodeOptions controls optional encoding features
+type EncodeOptions struct {
+	Compression Compression       // How to store the GLB region
+	Thumbnail   []byte            // PNG preview to embed, if any
+	Textures    TextureOptions    // How to transcode embedded textures
+	Meta        map[string]string // Metadata tags to embed, as Container.SetMeta
+}
+
+// Encode writes an NTSM file, filling in the magic, version, offsets and
+// sizes of hdr from the supplied GLB bytes and emitters. Emitters are
+// written, and decoded, in slice order
+func Encode(w io.Writer, hdr *Header, glbData []byte, emitters []ParticleEmitter) error {
+	return encode(w, hdr, payload{glb: glbData, emitters: emitters}, EncodeOptions{})
+}
+
+// EncodeWithTextures is like Encode but also embeds textures. The texture
+// table follows the particle data and the texture bytes follow the table
+func EncodeWithTextures(w io.Writer, hdr *Header, glbData []byte, emitters []ParticleEmitter, textures []Texture) error {
+	return encode(w, hdr, payload{glb: glbData, emitters: emitters, textures: textures}, EncodeOptions{})
+}
+
+// EncodeWithOptions is like EncodeWithTextures with additional options
+func EncodeWithOptions(w io.Writer, hdr *Header, glbData []byte, emitters []ParticleEmitter, textures []Texture, opts EncodeOptions) error {
+	return encode(w, hdr, payload{glb: glbData, emitters: emitters, textures: textures, meta: opts.Meta, thumbnail: opts.Thumbnail}, opts)
+}
+
+// encode lays out and writes the file. When p.meshes is set the first mesh
+// doubles as the primary GLB
+func encode(w io.Writer, hdr *Header, p payload, opts EncodeOptions) error {
+	if opts.Compression != CompressionNone && opts.Compression != CompressionDeflate {
+		return fmt.Errorf("ntsm: unknown compression %d", opts.Compression)
+	}
+	if !hdr.ByteOrder.valid() {
+		return fmt.Errorf("ntsm: unknown byte order %d", uint8(hdr.ByteOrder))
+	}
+	order := hdr.ByteOrder.binary()
+	if err := validateEmitters(p.emitters, len(p.textures)); err != nil {
+		return err
+	}
+	if opts.Textures.Format != "" {
+		var err error
+		if p.textures, err = TranscodeTextures(p.textures, opts.Textures); err != nil {
+			return err
+		}
+	}
+
+	meshes := p.meshes
+	if len(meshes) == 0 {
+		meshes = []GLBEntry{{Data: p.glb}}
+	}
+	multi := len(p.meshes) > 0
+
+	// An empty GLB is stored as is, even when compressing: deflating nothing
+	// still gives a couple of bytes, which readers would take for a region
+	// with no uncompressed size
+	compress := opts.Compression == CompressionDeflate &&
+		slices.ContainsFunc(meshes, func(m GLBEntry) bool { return len(m.Data) > 0 })
+
+	copy(hdr.Magic[:], Magic)
+	hdr.Version = emitterVersion(p.emitters)
+	hdr.SetCompressed(compress)
+	hdr.SetMultiMesh(multi)
+
+	offset := uint32(HeaderSize)
+	hdr.MeshTableOffset = 0
+	meshEntries := make([]MeshEntry, len(meshes))
+	if multi {
+		hdr.MeshTableOffset = offset
+		offset += 4 + uint32(len(meshEntries))*uint32(meshEntrySize)
+	}
+
+	blobs := make([][]byte, len(meshes))
+	for i, m := range meshes {
+		blobs[i] = m.Data
+		if compress && len(m.Data) > 0 {
+			meshEntries[i].RawSize = uint32(len(m.Data))
+			var err error
+			if blobs[i], err = compressGLB(m.Data); err != nil {
+				return err
 			}
 		}
+		putCString(meshEntries[i].Name[:], m.Name)
+		meshEntries[i].Offset = offset
+		meshEntries[i].Size = uint32(len(blobs[i]))
+		meshEntries[i].LODDistance = m.LODDistance
+		offset += meshEntries[i].Size
+	}
+	hdr.GLBOffset = meshEntries[0].Offset
+	hdr.GLBSize = meshEntries[0].Size
+	hdr.GLBRawSize = meshEntries[0].RawSize
+
+	hdr.ParticleOffset = offset
+	hdr.ParticleSize = uint32(len(p.emitters) * emitterSize(hdr.Version))
+	offset += hdr.ParticleSize
+	hdr.SetParticles(len(p.emitters) > 0)
+
+	hdr.TextureCount = uint32(len(p.textures))
+	hdr.TextureOffset = 0
+	entries := make([]TextureEntry, len(p.textures))
+	if len(p.textures) > 0 {
+		hdr.TextureOffset = offset
+		offset += uint32(len(entries)) * uint32(textureEntrySize)
+		for i, t := range p.textures {
+			putCString(entries[i].Name[:], t.Name)
+			putCString(entries[i].MimeType[:], t.MimeType)
+			entries[i].Size = uint32(len(t.Data))
+			entries[i].Offset = offset
+			offset += entries[i].Size
+		}
+	}
+
+	metaData, err := encodeMeta(p.meta, hdr.ByteOrder)
+	if err != nil {
+		return err
+	}
+	hdr.MetaOffset = 0
+	hdr.MetaSize = uint32(len(metaData))
+	hdr.Flags.set(FlagHasMeta, len(metaData) > 0)
+	if len(metaData) > 0 {
+		hdr.MetaOffset = offset
+		offset += hdr.MetaSize
+	}
+
+	hdr.ThumbnailOffset = 0
+	hdr.ThumbnailSize = uint32(len(p.thumbnail))
+	hdr.Flags.set(FlagHasThumbnail, len(p.thumbnail) > 0)
+	if len(p.thumbnail) > 0 {
+		hdr.ThumbnailOffset = offset
+		offset += hdr.ThumbnailSize
+	}
+
+	// Serialize the tables up front so the checksum can go in the header
+	var sections [][]byte
+	if multi {
+		var table bytes.Buffer
+		if err := binary.Write(&table, order, uint32(len(meshEntries))); err != nil {
+			return err
+		}
+		if err := binary.Write(&table, order, meshEntries); err != nil {
+			return err
+		}
+		sections = append(sections, table.Bytes())
+	}
+	sections = append(sections, blobs...)
+
+	particleData, err := encodeEmitters(p.emitters, hdr.ByteOrder, hdr.Version)
+	if err != nil {
+		return err
+	}
+	var tableData bytes.Buffer
+	if err := binary.Write(&tableData, order, entries); err != nil {
+		return err
+	}
+	sections = append(sections, particleData, tableData.Bytes())
+	for _, t := range p.textures {
+		sections = append(sections, t.Data)
+	}
+	sections = append(sections, metaData, p.thumbnail)
+
+	crc := crc32.NewIEEE()
+	for _, b := range sections {
+		crc.Write(b)
+	}
+	hdr.Checksum = crc.Sum32()
+
+	if err := writeHeader(w, order, hdr); err != nil {
+		return err
+	}
+	for _, b := range sections {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
 	}
 
-	return &hdr, glbData, emitters, nil
+	return nil
 }
@@ -0,0 +1,2151 @@
+package ntsm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"testing/iotest"
+	"unicode/utf8"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/golden.ntsm")
+
+const goldenPath = "testdata/golden.ntsm"
+
+// testGLB returns the smallest valid GLB: a header and a JSON chunk holding
+// only the asset version
+func testGLB() []byte {
+	return testGLBJSON(`{"asset":{"version":"2.0"}}`)
+}
+
+// testGLBJSON returns a GLB holding only the given JSON chunk
+func testGLBJSON(s string) []byte {
+	json := []byte(s)
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, []uint32{0x46546C67, 2, uint32(20 + len(json)), uint32(len(json)), glbJSONChunk})
+	b.Write(json)
+	return b.Bytes()
+}
+
+// testContainer returns a container with a tiny GLB and two emitters that
+// between them set every field to something other than its zero value
+func testContainer() *Container {
+	c := &Container{
+		GLB: testGLB(),
+		Emitters: []ParticleEmitter{
+			{
+				Position:         [3]float32{1, 2, 3},
+				Direction:        [3]float32{0, 1, 0},
+				SpreadAngle:      0.5,
+				EmissionRate:     20,
+				ParticleLifetime: 1.5,
+				StartSize:        0.25,
+				EndSize:          0.05,
+				StartColor:       [4]float32{1, 0.5, 0, 1},
+				EndColor:         [4]float32{1, 0, 0, 0},
+				VelocityMin:      [3]float32{-1, 1, -1},
+				VelocityMax:      [3]float32{1, 3, 1},
+				Gravity:          -9.8,
+				TextureIndex:     -1,
+				BlendMode:        BlendAdditive,
+				Loop:             1,
+				Easing:           EaseInOut,
+				GroupID:          7,
+			},
+			{
+				Position:         [3]float32{0, 0.5, 0},
+				Direction:        [3]float32{0, 0, 1},
+				EmissionRate:     5,
+				ParticleLifetime: 3,
+				StartSize:        1,
+				EndSize:          2,
+				StartColor:       [4]float32{0.2, 0.2, 0.2, 0.8},
+				TextureIndex:     -1,
+				BlendMode:        BlendAlpha,
+				Space:            SpaceWorld,
+				BurstCount:       64,
+			},
+		},
+	}
+	putCString(c.Header.Name[:], "golden")
+	return c
+}
+
+// encodeTest encodes c, failing the test on error
+func encodeTest(t *testing.T, c *Container) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := c.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// withHeader returns data with its header replaced by the header edit
+// leaves, keeping the rest of the file as it was
+func withHeader(t *testing.T, data []byte, edit func(*Header)) []byte {
+	t.Helper()
+	var hdr Header
+	if err := hdr.UnmarshalBinary(data[:HeaderSize]); err != nil {
+		t.Fatal(err)
+	}
+	edit(&hdr)
+	b, err := hdr.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return slices.Concat(b, data[HeaderSize:])
+}
+
+// checkDecoded compares a decode result against the container it came from
+func checkDecoded(t *testing.T, want *Container, hdr *Header, glb []byte, emitters []ParticleEmitter) {
+	t.Helper()
+	if *hdr != want.Header {
+		t.Errorf("header = %+v, want %+v", *hdr, want.Header)
+	}
+	if !bytes.Equal(glb, want.GLB) {
+		t.Errorf("GLB = %q, want %q", glb, want.GLB)
+	}
+	if !reflect.DeepEqual(emitters, want.Emitters) {
+		t.Errorf("emitters = %+v, want %+v", emitters, want.Emitters)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	c := testContainer()
+	data := encodeTest(t, c)
+
+	hdr, glb, emitters, _, err := DecodeWithOptions(bytes.NewReader(data), DecodeOptions{VerifyChecksum: true})
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	checkDecoded(t, c, hdr, glb, emitters)
+
+	hdr, glb, emitters, err = DecodeAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("DecodeAt: %v", err)
+	}
+	checkDecoded(t, c, hdr, glb, emitters)
+
+	var got Container
+	if _, err := got.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	checkDecoded(t, c, &got.Header, got.GLB, got.Emitters)
+
+	if err := Verify(bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	c := testContainer()
+	var buf bytes.Buffer
+	hdr := c.Header
+	if err := Encode(&buf, &hdr, c.GLB, c.Emitters); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	// Each record takes exactly EmitterSize bytes, with the padding after
+	// the emitter's fields
+	if want := uint32(len(c.Emitters) * EmitterSize); hdr.ParticleSize != want {
+		t.Errorf("ParticleSize = %d, want %d", hdr.ParticleSize, want)
+	}
+	if want := HeaderSize + len(c.GLB) + len(c.Emitters)*EmitterSize; buf.Len() != want {
+		t.Errorf("encoded %d bytes, want %d", buf.Len(), want)
+	}
+
+	got, glb, emitters, err := Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if *got != hdr {
+		t.Errorf("header = %+v, want %+v", *got, hdr)
+	}
+	if !bytes.Equal(glb, c.GLB) {
+		t.Errorf("GLB = %q, want %q", glb, c.GLB)
+	}
+	if !reflect.DeepEqual(emitters, c.Emitters) {
+		t.Errorf("emitters = %+v, want %+v", emitters, c.Emitters)
+	}
+}
+
+func TestUnalignedParticleSize(t *testing.T) {
+	data := encodeTest(t, testContainer())
+	hdr, err := DecodeHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Drop the last byte of the block so it no longer holds whole records
+	hdr.ParticleSize--
+	b, err := hdr.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(b, data[HeaderSize:len(data)-1]...)
+
+	if err := hdr.Validate(int64(len(data))); !errors.Is(err, ErrBadParticleSize) {
+		t.Errorf("Validate = %v, want ErrBadParticleSize", err)
+	}
+	if _, _, _, err := Decode(bytes.NewReader(data)); !errors.Is(err, ErrBadParticleSize) {
+		t.Errorf("Decode = %v, want ErrBadParticleSize", err)
+	}
+	if _, _, _, err := DecodeAt(bytes.NewReader(data), int64(len(data))); !errors.Is(err, ErrBadParticleSize) {
+		t.Errorf("DecodeAt = %v, want ErrBadParticleSize", err)
+	}
+}
+
+func TestDecodeAtOffset(t *testing.T) {
+	c := testContainer()
+	data := encodeTest(t, c)
+
+	// Move the GLB and particles 64 bytes further from the header, as a
+	// section inserted after it would
+	const gap = 64
+	hdr := c.Header
+	hdr.GLBOffset += gap
+	hdr.ParticleOffset += gap
+	hdr.Checksum = 0
+	b, err := hdr.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved := slices.Concat(b, make([]byte, gap), data[HeaderSize:])
+
+	// Embed the file in a larger blob, as in an archive or a pack file
+	prefix, suffix := bytes.Repeat([]byte{0xee}, 1000), bytes.Repeat([]byte{0xee}, 300)
+	blob := slices.Concat(prefix, moved, suffix)
+	got, glb, emitters, err := DecodeAt(io.NewSectionReader(bytes.NewReader(blob), int64(len(prefix)), int64(len(moved))), int64(len(moved)))
+	if err != nil {
+		t.Fatalf("DecodeAt: %v", err)
+	}
+	want := *c
+	want.Header = hdr
+	checkDecoded(t, &want, got, glb, emitters)
+
+	// A size cutting into the file is truncated even though the blob goes on
+	if _, _, _, err := DecodeAt(io.NewSectionReader(bytes.NewReader(blob), int64(len(prefix)), int64(len(moved))-1), int64(len(moved))-1); !errors.Is(err, ErrTruncated) {
+		t.Errorf("DecodeAt of a short section = %v, want ErrTruncated", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	c := testContainer()
+	data := encodeTest(t, c)
+	corrupt := slices.Clone(data)
+	corrupt[c.Header.ParticleOffset] ^= 0xff
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"bad magic", append([]byte("XTSM"), data[4:]...), ErrBadMagic},
+		{"GLB file", testGLB(), ErrBadMagic},
+		{"version 0", withHeader(t, data, func(h *Header) { h.Version = 0 }), &ErrUnsupportedVersion{}},
+		{"truncated header", data[:HeaderSize-1], ErrTruncated},
+		{"truncated GLB", data[:c.Header.GLBOffset+1], ErrTruncated},
+		{"truncated particles", data[:len(data)-1], ErrTruncated},
+		{"unaligned particle size", withHeader(t, data, func(h *Header) { h.ParticleSize-- }), ErrBadParticleSize},
+		{"empty particle block", withHeader(t, data, func(h *Header) { h.ParticleSize = 0 }), ErrBadParticleSize},
+		{"checksum mismatch", corrupt, ErrChecksumMismatch},
+	} {
+		if _, _, _, _, err := DecodeWithOptions(bytes.NewReader(tt.data), DecodeOptions{VerifyChecksum: true}); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Decode = %v, want %v", tt.name, err, tt.want)
+		}
+		if _, err := DecodeBytes(tt.data); !errors.Is(err, tt.want) {
+			t.Errorf("%s: DecodeBytes = %v, want %v", tt.name, err, tt.want)
+		}
+		if err := Verify(bytes.NewReader(tt.data), int64(len(tt.data))); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Verify = %v, want %v", tt.name, err, tt.want)
+		}
+		if errors.Is(tt.want, ErrTruncated) {
+			if _, _, _, err := Decode(bytes.NewReader(tt.data)); !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("%s: Decode = %v, want io.ErrUnexpectedEOF alongside ErrTruncated", tt.name, err)
+			}
+		}
+	}
+}
+
+func TestFutureVersion(t *testing.T) {
+	data := encodeTest(t, testContainer())
+	for v := uint32(MinVersion); v <= MaxVersion; v++ {
+		hdr := Header{Version: v}
+		if err := hdr.RequireVersion(); err != nil {
+			t.Errorf("RequireVersion(%d) = %v", v, err)
+		}
+	}
+
+	// A file newer than this package is refused rather than misread, by
+	// every decoder
+	future := withHeader(t, data, func(h *Header) { h.Version = Version + 1 })
+	_, err := DecodeHeader(bytes.NewReader(future))
+	var verr *ErrUnsupportedVersion
+	if !errors.As(err, &verr) || *verr != (ErrUnsupportedVersion{Got: Version + 1, Min: MinVersion, Max: MaxVersion}) {
+		t.Fatalf("DecodeHeader = %v, want ErrUnsupportedVersion for version %d", err, Version+1)
+	}
+	if !strings.Contains(err.Error(), "newer") {
+		t.Errorf("error %q doesn't say the file is newer", err)
+	}
+	if _, _, _, err := Decode(bytes.NewReader(future)); !errors.Is(err, &ErrUnsupportedVersion{}) {
+		t.Errorf("Decode = %v, want ErrUnsupportedVersion", err)
+	}
+	if _, _, _, err := DecodeAt(bytes.NewReader(future), int64(len(future))); !errors.Is(err, &ErrUnsupportedVersion{}) {
+		t.Errorf("DecodeAt = %v, want ErrUnsupportedVersion", err)
+	}
+	// The random-access readers take the header on trust, so check them
+	// with one that skipped DecodeHeader
+	var hdr Header
+	if err := hdr.UnmarshalBinary(future[:HeaderSize]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeEmitterAt(bytes.NewReader(future), &hdr, 0); !errors.Is(err, &ErrUnsupportedVersion{}) {
+		t.Errorf("DecodeEmitterAt = %v, want ErrUnsupportedVersion", err)
+	}
+	var seqErr error
+	for _, err := range hdr.EmitterSeq(bytes.NewReader(future)) {
+		seqErr = err
+		break
+	}
+	if !errors.Is(seqErr, &ErrUnsupportedVersion{}) {
+		t.Errorf("EmitterSeq = %v, want ErrUnsupportedVersion", seqErr)
+	}
+
+	enc := NewEncoder(new(bytes.Buffer))
+	if err := enc.WriteHeader(&Header{Version: MaxVersion + 1}); !errors.Is(err, &ErrUnsupportedVersion{}) {
+		t.Errorf("Encoder.WriteHeader = %v, want ErrUnsupportedVersion", err)
+	}
+}
+
+func TestValidateMalformed(t *testing.T) {
+	c := testContainer()
+	c.Textures = []Texture{{Name: "spark", MimeType: "image/png", Data: []byte("png")}}
+	data := encodeTest(t, c)
+	h := c.Header
+	size := int64(len(data))
+	glbEnd := h.GLBOffset + h.GLBSize
+
+	for _, tt := range []struct {
+		name string
+		edit func(*Header)
+		want error // nil for errors without a sentinel
+	}{
+		{"GLB in the header", func(h *Header) { h.GLBOffset = HeaderSize - 4 }, nil},
+		{"particles overlapping the GLB", func(h *Header) { h.ParticleOffset = glbEnd - 1 }, nil},
+		{"textures overlapping the particles", func(h *Header) { h.TextureOffset = h.ParticleOffset }, nil},
+		{"mesh table in the header", func(h *Header) { h.SetMultiMesh(true); h.MeshTableOffset = 0 }, nil},
+		{"GLB past EOF", func(h *Header) { h.GLBOffset = uint32(size) }, ErrTruncated},
+		{"huge GLB", func(h *Header) { h.GLBSize = math.MaxUint32 }, ErrTruncated},
+		{"particles past EOF", func(h *Header) { h.ParticleOffset = uint32(size) }, ErrTruncated},
+		{"texture table past EOF", func(h *Header) { h.TextureCount = 1000 }, ErrTruncated},
+		{"texture count overflow", func(h *Header) { h.TextureCount = math.MaxUint32 }, nil},
+		{"unaligned particles", func(h *Header) { h.ParticleSize -= 4 }, ErrBadParticleSize},
+	} {
+		hdr := h
+		tt.edit(&hdr)
+		err := hdr.Validate(size)
+		if err == nil || tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: Validate = %v, want %v", tt.name, err, tt.want)
+		}
+		// Decode must fail too, before reading or allocating a section,
+		// though an edit may break more than one check
+		bad := withHeader(t, data, tt.edit)
+		if _, _, _, err := DecodeAt(bytes.NewReader(bad), size); err == nil {
+			t.Errorf("%s: DecodeAt succeeded", tt.name)
+		}
+	}
+
+	for _, n := range []int{0, 4, HeaderSize - 1} {
+		if _, err := DecodeHeader(bytes.NewReader(data[:n])); !errors.Is(err, ErrTruncated) {
+			t.Errorf("DecodeHeader of %d bytes = %v, want ErrTruncated", n, err)
+		}
+	}
+}
+
+func TestDraftFlags(t *testing.T) {
+	data := encodeTest(t, testContainer())
+
+	// A draft writer set bit 1 for world space and nothing else
+	bad := withHeader(t, data, func(h *Header) { h.Flags |= FlagGLBCompressed })
+	_, _, _, err := Decode(bytes.NewReader(bad))
+	if !errors.Is(err, ErrDraftFlags) || !strings.Contains(err.Error(), "use_world_space") {
+		t.Errorf("Decode = %v, want ErrDraftFlags naming use_world_space", err)
+	}
+	if err := Verify(bytes.NewReader(bad), int64(len(bad))); !errors.Is(err, ErrDraftFlags) {
+		t.Errorf("Verify = %v, want ErrDraftFlags", err)
+	}
+
+	// Bits 2 and 3 are unused, so readers ignore them
+	unused := withHeader(t, data, func(h *Header) { h.Flags |= 1<<2 | 1<<3 })
+	if _, _, _, err := Decode(bytes.NewReader(unused)); err != nil {
+		t.Errorf("Decode with bits 2 and 3 set: %v", err)
+	}
+
+	// Files that use the bits as specified still decode
+	c := testContainer()
+	c.SetThumbnail([]byte("\x89PNG thumb"))
+	c.Meshes = []GLBEntry{{Name: "near", Data: c.GLB}, {Name: "far", Data: c.GLB, LODDistance: 50}}
+	if _, err := DecodeBytes(encodeTest(t, c)); err != nil {
+		t.Errorf("multi-mesh file with a thumbnail: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := EncodeWithOptions(&buf, &Header{}, c.GLB, nil, nil, EncodeOptions{Compression: CompressionDeflate}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeBytes(buf.Bytes()); err != nil {
+		t.Errorf("compressed file: %v", err)
+	}
+}
+
+// TestCompressEmptyGLB encodes empty GLBs with deflate: they are stored
+// uncompressed, so every file Encode writes decodes
+func TestCompressEmptyGLB(t *testing.T) {
+	opts := EncodeOptions{Compression: CompressionDeflate}
+	var buf bytes.Buffer
+	if err := EncodeWithOptions(&buf, &Header{}, nil, testContainer().Emitters, nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	c, err := DecodeBytes(buf.Bytes())
+	if err != nil {
+		t.Fatalf("DecodeBytes: %v", err)
+	}
+	if c.Header.IsCompressed() || c.Header.GLBSize != 0 || len(c.GLB) != 0 {
+		t.Errorf("flags %s, GLBSize %d, GLB %d bytes; want an empty uncompressed GLB", c.Header.Flags, c.Header.GLBSize, len(c.GLB))
+	}
+
+	// An empty level among compressed ones is stored empty
+	glb := testGLB()
+	c = &Container{Meshes: []GLBEntry{{Name: "near", Data: glb}, {Name: "empty"}}}
+	c.Header.SetCompressed(true)
+	c, err = DecodeBytes(encodeTest(t, c))
+	if err != nil {
+		t.Fatalf("DecodeBytes of multi-mesh: %v", err)
+	}
+	if !c.Header.IsCompressed() || len(c.Meshes) != 2 || !bytes.Equal(c.Meshes[0].Data, glb) || len(c.Meshes[1].Data) != 0 {
+		t.Errorf("flags %s, %d meshes; want the compressed GLB and an empty one", c.Header.Flags, len(c.Meshes))
+	}
+}
+
+// TestGolden catches format changes: the checked-in file must decode to
+// testContainer, and encoding testContainer must reproduce it byte for byte.
+// Run with -update after an intended change
+func TestGolden(t *testing.T) {
+	c := testContainer()
+	data := encodeTest(t, c)
+	if *update {
+		if err := os.WriteFile(goldenPath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	golden, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr, glb, emitters, _, err := DecodeWithOptions(bytes.NewReader(golden), DecodeOptions{VerifyChecksum: true})
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	checkDecoded(t, c, hdr, glb, emitters)
+
+	if !bytes.Equal(data, golden) {
+		t.Errorf("encoding changed: got %d bytes, golden has %d", len(data), len(golden))
+	}
+}
+
+// TestDeterministic checks that encoding the same contents twice, through
+// differently built containers, gives identical bytes
+func TestDeterministic(t *testing.T) {
+	build := func() *Container {
+		c := testContainer()
+		c.Header.SetCompressed(true)
+		c.Meshes = []GLBEntry{{Name: "high", Data: testGLB()}, {Name: "low", Data: testGLB(), LODDistance: 50}}
+		c.Textures = []Texture{{Name: "spark", MimeType: "image/png", Data: []byte("png")}}
+		c.SetThumbnail([]byte("\x89PNG thumb"))
+		for _, k := range []string{"author", "license", "source", "version"} {
+			c.SetMeta(k, k+" value")
+		}
+		return c
+	}
+	want := encodeTest(t, build())
+
+	// A name overwritten in place leaves stale bytes after the terminator
+	c := build()
+	putCString(c.Header.Name[:], "a much longer name than golden")
+	copy(c.Header.Name[:], "golden\x00")
+	if got := encodeTest(t, c); !bytes.Equal(got, want) {
+		t.Error("encoding differs after renaming in place")
+	}
+	for range 3 {
+		if got := encodeTest(t, build()); !bytes.Equal(got, want) {
+			t.Fatal("encoding the same container twice differs")
+		}
+	}
+}
+
+func TestMeta(t *testing.T) {
+	c := testContainer()
+	c.Textures = []Texture{{Name: "spark", MimeType: "image/png", Data: []byte("png")}}
+	c.SetThumbnail([]byte("\x89PNG thumb"))
+	c.SetMeta("license", "CC-BY-4.0")
+	c.SetMeta("author", "netisu")
+	c.SetMeta("empty", "")
+	data := encodeTest(t, c)
+	if !c.Header.HasMeta() {
+		t.Fatal("has_meta not set")
+	}
+
+	// Encoding must not depend on the order tags were set in
+	other := testContainer()
+	other.Textures = c.Textures
+	other.SetThumbnail([]byte("\x89PNG thumb"))
+	other.SetMeta("empty", "")
+	other.SetMeta("author", "netisu")
+	other.SetMeta("license", "CC-BY-4.0")
+	if !bytes.Equal(encodeTest(t, other), data) {
+		t.Error("encoding depends on tag insertion order")
+	}
+
+	var got Container
+	if _, err := got.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	if !reflect.DeepEqual(got.Meta(), c.Meta()) {
+		t.Errorf("Meta() = %v, want %v", got.Meta(), c.Meta())
+	}
+	if thumb, _ := got.Thumbnail(); string(thumb) != "\x89PNG thumb" {
+		t.Errorf("thumbnail = %q after metadata", thumb)
+	}
+
+	// Decode doesn't return metadata but must still read past it
+	_, glb, _, err := Decode(bytes.NewReader(data))
+	if err != nil || !bytes.Equal(glb, c.GLB) {
+		t.Errorf("Decode = %q, %v", glb, err)
+	}
+	if _, _, _, _, err := DecodeWithOptions(bytes.NewReader(data), DecodeOptions{VerifyChecksum: true}); err != nil {
+		t.Errorf("Decode with checksum: %v", err)
+	}
+	if err := Verify(bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+
+	c.SetMeta("", "x")
+	if _, err := c.WriteTo(io.Discard); err == nil {
+		t.Error("WriteTo accepted an empty key")
+	}
+}
+
+func TestAttribution(t *testing.T) {
+	c := testContainer()
+	const credit = "“Golden” by netisu, CC BY 4.0"
+	var buf bytes.Buffer
+	opts := EncodeOptions{Meta: map[string]string{MetaAttribution: credit}}
+	if err := EncodeWithOptions(&buf, &c.Header, c.GLB, c.Emitters, nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	meta, err := ReadMeta(bytes.NewReader(buf.Bytes()))
+	if err != nil || meta[MetaAttribution] != credit {
+		t.Errorf("ReadMeta = %v, %v; want attribution %q", meta, err, credit)
+	}
+
+	buf.Reset()
+	if err := EncodeWithOptions(&buf, &c.Header, c.GLB, c.Emitters, nil, EncodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if meta, err := ReadMeta(bytes.NewReader(buf.Bytes())); meta != nil || err != nil {
+		t.Errorf("ReadMeta without metadata = %v, %v", meta, err)
+	}
+}
+
+func TestDecodeBytes(t *testing.T) {
+	c := testContainer()
+	c.Textures = []Texture{{Name: "spark", MimeType: "image/png", Data: []byte("png")}}
+	c.SetMeta("author", "netisu")
+	data := encodeTest(t, c)
+
+	got, err := DecodeBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDecoded(t, c, &got.Header, got.GLB, got.Emitters)
+	if !reflect.DeepEqual(got.Textures, c.Textures) || got.Meta()["author"] != "netisu" {
+		t.Errorf("textures %+v, meta %v", got.Textures, got.Meta())
+	}
+	clear(data)
+	if !bytes.Equal(got.GLB, c.GLB) {
+		t.Error("decoded GLB aliases the input")
+	}
+
+	data = encodeTest(t, c)
+	data[c.Header.GLBOffset+30] ^= 0xff // Inside the GLB's JSON
+	if _, err := DecodeBytes(data); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("corrupt file decoded with %v, want ErrChecksumMismatch", err)
+	}
+	if _, err := DecodeBytes(data[:HeaderSize+4]); err == nil {
+		t.Error("truncated file decoded")
+	}
+}
+
+// plainFS hides io.ReaderAt on the files it opens, as an fs.FS backed by a
+// stream would
+type plainFS struct{ fs.FS }
+
+func (p plainFS) Open(name string) (fs.File, error) {
+	f, err := p.FS.Open(name)
+	return struct{ fs.File }{f}, err
+}
+
+func TestDecodeFS(t *testing.T) {
+	c := testContainer()
+	c.Textures = []Texture{{Name: "spark", MimeType: "image/png", Data: []byte("png")}}
+	c.SetMeta("author", "netisu")
+	data := encodeTest(t, c)
+	fsys := fstest.MapFS{
+		"fx/sword.ntsm": {Data: data},
+		"fx/short.ntsm": {Data: data[:len(data)-1]},
+	}
+
+	for _, tt := range []struct {
+		name string
+		fsys fs.FS
+	}{
+		{"ReaderAt", fsys},
+		{"plain", plainFS{fsys}},
+	} {
+		f, err := tt.fsys.Open("fx/sword.ntsm")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := f.(io.ReaderAt); ok != (tt.name == "ReaderAt") {
+			t.Fatalf("%s: file implements io.ReaderAt = %v", tt.name, ok)
+		}
+		f.Close()
+
+		got, err := DecodeFS(tt.fsys, "fx/sword.ntsm")
+		if err != nil {
+			t.Fatalf("%s: DecodeFS: %v", tt.name, err)
+		}
+		checkDecoded(t, c, &got.Header, got.GLB, got.Emitters)
+		if !reflect.DeepEqual(got.Textures, c.Textures) || got.Meta()["author"] != "netisu" {
+			t.Errorf("%s: textures %+v, meta %v", tt.name, got.Textures, got.Meta())
+		}
+
+		if _, err := DecodeFS(tt.fsys, "fx/short.ntsm"); !errors.Is(err, ErrTruncated) || !strings.HasPrefix(err.Error(), "fx/short.ntsm: ") {
+			t.Errorf("%s: DecodeFS of a truncated file = %v, want ErrTruncated prefixed with its name", tt.name, err)
+		}
+		if _, err := DecodeFS(tt.fsys, "fx/missing.ntsm"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s: DecodeFS of a missing file = %v, want fs.ErrNotExist", tt.name, err)
+		}
+	}
+}
+
+func TestDecodeFile(t *testing.T) {
+	c := testContainer()
+	path := filepath.Join(t.TempDir(), "items", "fx", "sword.ntsm")
+	hdr := c.Header
+	if err := EncodeFile(path, &hdr, c.GLB, c.Emitters); err != nil {
+		t.Fatalf("EncodeFile: %v", err)
+	}
+	got, glb, emitters, err := DecodeFile(path)
+	if err != nil {
+		t.Fatalf("DecodeFile: %v", err)
+	}
+	c.Header = hdr
+	checkDecoded(t, c, got, glb, emitters)
+
+	missing := filepath.Join(t.TempDir(), "missing.ntsm")
+	if _, _, _, err := DecodeFile(missing); !errors.Is(err, fs.ErrNotExist) || !strings.Contains(err.Error(), missing) {
+		t.Errorf("DecodeFile of a missing file = %v, want fs.ErrNotExist naming the path", err)
+	}
+	short := filepath.Join(t.TempDir(), "short.ntsm")
+	data, _ := os.ReadFile(path)
+	if err := os.WriteFile(short, data[:len(data)-1], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := DecodeFile(short); !errors.Is(err, ErrTruncated) || !strings.HasPrefix(err.Error(), short+": ") {
+		t.Errorf("DecodeFile of a truncated file = %v, want ErrTruncated prefixed with the path", err)
+	}
+	// A parent that is a file can't be created as a directory
+	if err := EncodeFile(filepath.Join(short, "sword.ntsm"), &hdr, c.GLB, c.Emitters); err == nil {
+		t.Error("EncodeFile under a regular file succeeded")
+	}
+
+	if os.Geteuid() == 0 {
+		t.Skip("permissions aren't enforced for root")
+	}
+	locked := filepath.Join(t.TempDir(), "locked")
+	if err := os.Mkdir(locked, 0500); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncodeFile(filepath.Join(locked, "sword.ntsm"), &hdr, c.GLB, c.Emitters); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("EncodeFile into a read-only directory = %v, want fs.ErrPermission", err)
+	}
+	if err := os.Chmod(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := DecodeFile(path); !errors.Is(err, fs.ErrPermission) || !strings.Contains(err.Error(), path) {
+		t.Errorf("DecodeFile of an unreadable file = %v, want fs.ErrPermission naming the path", err)
+	}
+}
+
+func TestAppendEmitters(t *testing.T) {
+	c := testContainer()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sword.ntsm")
+	if err := os.WriteFile(path, encodeTest(t, c), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	emitters := []ParticleEmitter{c.Emitters[1], c.Emitters[0], c.Emitters[1]}
+	emitters[0].Seed = 42 // Needs a version 3 record
+	if err := AppendEmitters(path, emitters); err != nil {
+		t.Fatalf("AppendEmitters: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Errorf("Verify after AppendEmitters: %v", err)
+	}
+	got, err := DecodeBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data[c.Header.GLBOffset:c.Header.GLBOffset+c.Header.GLBSize], c.GLB) || !bytes.Equal(got.GLB, c.GLB) {
+		t.Error("AppendEmitters changed the GLB")
+	}
+	if !reflect.DeepEqual(got.Emitters, emitters) || got.Header.Version != 3 {
+		t.Errorf("emitters = %+v in version %d, want %+v in version 3", got.Emitters, got.Header.Version, emitters)
+	}
+
+	// Removing every emitter leaves a file that ends with the GLB
+	if err := AppendEmitters(path, nil); err != nil {
+		t.Fatalf("AppendEmitters(nil): %v", err)
+	}
+	data, _ = os.ReadFile(path)
+	if got, err := DecodeBytes(data); err != nil || len(got.Emitters) != 0 || got.Header.HasParticles() {
+		t.Errorf("after removing emitters: %+v, %v", got, err)
+	}
+
+	// Files where the particles aren't last are left as they were
+	for _, tt := range []struct {
+		name string
+		edit func(*Container)
+	}{
+		{"textures", func(c *Container) {
+			c.Textures = []Texture{{Name: "spark", MimeType: "image/png", Data: []byte("png")}}
+		}},
+		{"meta", func(c *Container) { c.SetMeta("author", "netisu") }},
+		{"thumbnail", func(c *Container) { c.SetThumbnail([]byte("\x89PNG\r\n\x1a\n")) }},
+	} {
+		c := testContainer()
+		tt.edit(c)
+		orig := encodeTest(t, c)
+		path := filepath.Join(dir, tt.name+".ntsm")
+		if err := os.WriteFile(path, orig, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := AppendEmitters(path, emitters); err == nil {
+			t.Errorf("%s: AppendEmitters succeeded", tt.name)
+		}
+		if data, _ := os.ReadFile(path); !bytes.Equal(data, orig) {
+			t.Errorf("%s: rejected AppendEmitters changed the file", tt.name)
+		}
+	}
+}
+
+// cancelAfter passes reads and writes through and cancels its context once
+// n bytes have gone by, like a slow transfer interrupted part way
+type cancelAfter struct {
+	r      io.Reader
+	w      io.Writer
+	n      int
+	cancel context.CancelFunc
+	done   int
+}
+
+func (c *cancelAfter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.count(n)
+	return n, err
+}
+
+func (c *cancelAfter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.count(n)
+	return n, err
+}
+
+func (c *cancelAfter) count(n int) {
+	if c.done += n; c.done >= c.n {
+		c.cancel()
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	// A GLB large enough to take many chunks
+	c := testContainer()
+	c.GLB = testGLBJSON(`{"asset":{"version":"2.0","generator":"` + strings.Repeat("x", 8*ioChunk) + `"}}`)
+	data := encodeTest(t, c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &cancelAfter{r: bytes.NewReader(data), n: 2 * ioChunk, cancel: cancel}
+	if _, _, _, err := DecodeContext(ctx, r); !errors.Is(err, context.Canceled) {
+		t.Errorf("DecodeContext = %v, want context.Canceled", err)
+	}
+	if r.done >= len(data) {
+		t.Errorf("DecodeContext read all %d bytes after being cancelled", r.done)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	var buf bytes.Buffer
+	w := &cancelAfter{w: &buf, n: 2 * ioChunk, cancel: cancel}
+	if err := EncodeContext(ctx, w, &c.Header, c.GLB, c.Emitters, nil, EncodeOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("EncodeContext = %v, want context.Canceled", err)
+	}
+	if buf.Len() >= len(data) {
+		t.Errorf("EncodeContext wrote all %d bytes after being cancelled", buf.Len())
+	}
+	if n, err := io.Copy(io.Discard, ContextReader(ctx, bytes.NewReader(data))); !errors.Is(err, context.Canceled) || n != 0 {
+		t.Errorf("copying from ContextReader = %d, %v; want 0, context.Canceled", n, err)
+	}
+
+	// Uncancelled, both run to completion
+	hdr, glb, emitters, err := DecodeContext(context.Background(), bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeContext: %v", err)
+	}
+	checkDecoded(t, c, hdr, glb, emitters)
+	buf.Reset()
+	if err := EncodeContext(context.Background(), &buf, &c.Header, c.GLB, c.Emitters, nil, EncodeOptions{}); err != nil || !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("EncodeContext = %v, or output differs from WriteTo", err)
+	}
+}
+
+func TestDecodeAutoCompressed(t *testing.T) {
+	c := testContainer()
+	c.SetMeta("author", "netisu")
+	data := encodeTest(t, c)
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(data)
+	zw.Close()
+
+	for name, in := range map[string][]byte{"plain": data, "gzip": gz.Bytes()} {
+		got, err := DecodeAutoCompressed(bytes.NewReader(in))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		checkDecoded(t, c, &got.Header, got.GLB, got.Emitters)
+		if got.Meta()["author"] != "netisu" {
+			t.Errorf("%s: meta = %v", name, got.Meta())
+		}
+	}
+
+	corrupt := bytes.Clone(gz.Bytes())
+	corrupt[len(corrupt)-5] ^= 0xff // In the gzip CRC
+	if _, err := DecodeAutoCompressed(bytes.NewReader(corrupt)); err == nil {
+		t.Error("decoded a gzip stream with a bad CRC")
+	}
+	zstd := append([]byte{0x28, 0xb5, 0x2f, 0xfd}, data...)
+	if _, err := DecodeAutoCompressed(bytes.NewReader(zstd)); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("zstd input: %v, want errors.ErrUnsupported", err)
+	}
+}
+
+func TestDecodeMetaMalformed(t *testing.T) {
+	for _, data := range [][]byte{
+		{},
+		{1, 0, 0, 0},                         // One pair, no data
+		{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}, // Count larger than the data
+		{1, 0, 0, 0, 9, 0, 0, 0, 'k', 0, 0, 0, 0}, // Key length past the end
+		{0, 0, 0, 0, 1}, // Bytes after the last pair
+	} {
+		if _, err := decodeMeta(data, LittleEndian); err == nil {
+			t.Errorf("decodeMeta(%v) succeeded", data)
+		}
+	}
+}
+
+func TestArchive(t *testing.T) {
+	// Each entry ends with a different section, so the reader has to find
+	// the end of each one from its own tables
+	plain := testContainer()
+	plain.Emitters = nil
+
+	textured := testContainer()
+	putCString(textured.Header.Name[:], "textured")
+	textured.Textures = []Texture{{Name: "spark", MimeType: "image/png", Data: []byte("png data")}}
+	textured.Emitters[0].TextureIndex = 0
+	textured.SetMeta("author", "netisu")
+
+	thumbed := testContainer()
+	putCString(thumbed.Header.Name[:], "thumbed")
+	thumbed.Header.Flags |= FlagGLBCompressed
+	thumbed.SetThumbnail([]byte("\x89PNG thumb"))
+
+	var buf bytes.Buffer
+	aw := NewArchiveWriter(&buf)
+	want := []*Container{plain, textured, thumbed}
+	for _, c := range want {
+		if err := aw.WriteContainer(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// One byte at a time, so nothing relies on reads returning whole sections
+	ar := NewArchiveReader(iotest.OneByteReader(&buf))
+	if n, err := ar.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("Read before Next = %d, %v", n, err)
+	}
+	for i, w := range want {
+		hdr, err := ar.Next()
+		if err != nil {
+			t.Fatalf("Next %d: %v", i, err)
+		}
+		if hdr.NameString() != w.Header.NameString() {
+			t.Errorf("entry %d name = %q, want %q", i, hdr.NameString(), w.Header.NameString())
+		}
+		glb, err := io.ReadAll(ar)
+		if err != nil || !bytes.Equal(glb, w.GLB) {
+			t.Errorf("entry %d GLB = %q, %v", i, glb, err)
+		}
+		if !reflect.DeepEqual(ar.Emitters(), w.Emitters) {
+			t.Errorf("entry %d emitters = %+v, want %+v", i, ar.Emitters(), w.Emitters)
+		}
+		c := ar.Container()
+		if !reflect.DeepEqual(c.Textures, w.Textures) || !reflect.DeepEqual(c.Meta(), w.Meta()) {
+			t.Errorf("entry %d textures or metadata differ", i)
+		}
+		if got, _ := c.Thumbnail(); !bytes.Equal(got, w.thumbnail) {
+			t.Errorf("entry %d thumbnail = %q", i, got)
+		}
+	}
+	if _, err := ar.Next(); err != io.EOF {
+		t.Errorf("Next after the last entry = %v, want io.EOF", err)
+	}
+
+	// A partial entry is an error, not a clean end
+	var partial bytes.Buffer
+	NewArchiveWriter(&partial).WriteContainer(plain)
+	ar = NewArchiveReader(bytes.NewReader(partial.Bytes()[:partial.Len()-1]))
+	if _, err := ar.Next(); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Next on a truncated entry = %v, want ErrTruncated", err)
+	}
+}
+
+func TestSetName(t *testing.T) {
+	for _, tt := range []struct {
+		name, want string
+	}{
+		{"", ""},
+		{"sword", "sword"},
+		{strings.Repeat("a", 127), strings.Repeat("a", 127)},
+		{strings.Repeat("a", 128), strings.Repeat("a", 127)},
+		{strings.Repeat("a", 200), strings.Repeat("a", 127)},
+		// A 4-byte emoji straddling byte 127 is dropped whole
+		{strings.Repeat("a", 125) + "🔥", strings.Repeat("a", 125)},
+		{strings.Repeat("a", 123) + "🔥", strings.Repeat("a", 123) + "🔥"},
+		// 3-byte CJK runes: 42 fit in 126 bytes, the 43rd would reach 129
+		{strings.Repeat("剣", 50), strings.Repeat("剣", 42)},
+	} {
+		var h Header
+		copy(h.Name[:], strings.Repeat("x", len(h.Name)))
+		h.SetName(tt.name)
+		got := h.NameString()
+		if got != tt.want || !utf8.ValidString(got) {
+			t.Errorf("SetName(%d bytes) stored %d bytes %q, want %d bytes", len(tt.name), len(got), got, len(tt.want))
+		}
+		if rest := h.Name[len(got):]; bytes.Count(rest, []byte{0}) != len(rest) {
+			t.Errorf("SetName(%d bytes) left bytes after the name: %q", len(tt.name), rest)
+		}
+	}
+}
+
+func TestNameString(t *testing.T) {
+	// A name filling the field with no terminator, as another writer may
+	// leave it, is read whole
+	var h Header
+	copy(h.Name[:], strings.Repeat("b", len(h.Name)))
+	if got := h.NameString(); got != strings.Repeat("b", len(h.Name)) {
+		t.Errorf("unterminated NameString = %d bytes %q", len(got), got)
+	}
+	// Bytes after the first null are ignored
+	h = Header{}
+	copy(h.Name[:], "hat\x00old name")
+	if got := h.NameString(); got != "hat" {
+		t.Errorf("NameString = %q, want hat", got)
+	}
+
+	// Names survive encoding, up to the 127-byte limit
+	for _, name := range []string{"", "hat", strings.Repeat("c", 127), strings.Repeat("d", 200)} {
+		c := testContainer()
+		c.Header.SetName(name)
+		got, err := DecodeBytes(encodeTest(t, c))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := name[:min(len(name), 127)]; got.Header.NameString() != want {
+			t.Errorf("decoded name of %d bytes = %q, want %q", len(name), got.Header.NameString(), want)
+		}
+	}
+}
+
+func TestTrailingBytes(t *testing.T) {
+	c := testContainer()
+	data := encodeTest(t, c)
+	size := int64(len(data))
+	if n := c.Header.TrailingBytes(size); n != 0 {
+		t.Errorf("TrailingBytes of a clean file = %d, want 0", n)
+	}
+	if n := c.Header.TrailingBytes(size + 17); n != 17 {
+		t.Errorf("TrailingBytes with 17 extra bytes = %d, want 17", n)
+	}
+	if n := c.Header.TrailingBytes(size - 1); n != 0 {
+		t.Errorf("TrailingBytes of a short file = %d, want 0", n)
+	}
+	extra := append(slices.Clone(data), "junk"...)
+	if err := Verify(bytes.NewReader(extra), int64(len(extra))); !errors.Is(err, ErrTrailingData) {
+		t.Errorf("Verify with trailing bytes = %v, want ErrTrailingData", err)
+	}
+
+	fixture, err := os.ReadFile("tests/glb/trailing.ntsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr, err := DecodeHeader(bytes.NewReader(fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := hdr.TrailingBytes(int64(len(fixture))); n == 0 {
+		t.Error("trailing.ntsm has no trailing bytes")
+	}
+
+	// Texture data is past every region the header describes, unless a
+	// thumbnail follows it
+	c.Textures = []Texture{{Name: "spark", MimeType: "image/png", Data: []byte("png data")}}
+	data = encodeTest(t, c)
+	if n := c.Header.TrailingBytes(int64(len(data))); n != int64(len("png data")) {
+		t.Errorf("TrailingBytes with texture data = %d, want %d", n, len("png data"))
+	}
+	if err := Verify(bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Errorf("Verify with texture data: %v", err)
+	}
+	c.SetThumbnail([]byte("\x89PNG thumb"))
+	data = encodeTest(t, c)
+	if n := c.Header.TrailingBytes(int64(len(data))); n != 0 {
+		t.Errorf("TrailingBytes with a thumbnail last = %d, want 0", n)
+	}
+}
+
+func TestHeaderSize(t *testing.T) {
+	// New fields must fit in the reserved space, or raise HeaderSize
+	if size := binary.Size(Header{}); size > HeaderSize || ReservedSize != HeaderSize-size {
+		t.Fatalf("Header struct is %d bytes with %d reserved, HeaderSize is %d", size, ReservedSize, HeaderSize)
+	}
+
+	c := testContainer()
+	c.Textures = []Texture{{Name: "spark", Data: []byte("png")}}
+	data := encodeTest(t, c)
+	hdr, err := DecodeHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeHeader(&buf, binary.LittleEndian, hdr); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != HeaderSize {
+		t.Fatalf("header is %d bytes, want %d", buf.Len(), HeaderSize)
+	}
+	if !bytes.Equal(buf.Bytes(), data[:HeaderSize]) {
+		t.Error("rewritten header differs from the encoded one")
+	}
+	for i, b := range buf.Bytes()[HeaderSize-ReservedSize:] {
+		if b != 0 {
+			t.Errorf("padding byte %d is %#x, want 0", i, b)
+		}
+	}
+}
+
+func TestHeaderBinary(t *testing.T) {
+	var _ encoding.BinaryMarshaler = (*Header)(nil)
+	var _ encoding.BinaryUnmarshaler = (*Header)(nil)
+
+	for _, order := range []ByteOrder{LittleEndian, BigEndian} {
+		c := testContainer()
+		c.Header.ByteOrder = order
+		data := encodeTest(t, c)
+
+		raw, err := c.Header.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(raw, data[:HeaderSize]) {
+			t.Errorf("%v: MarshalBinary differs from the encoded header", order)
+		}
+		var got Header
+		if err := got.UnmarshalBinary(raw); err != nil || got != c.Header {
+			t.Errorf("%v: UnmarshalBinary = %+v, %v, want %+v", order, got, err, c.Header)
+		}
+	}
+
+	// Malformed headers still decode, for inspection
+	raw := make([]byte, HeaderSize)
+	copy(raw, "JUNK")
+	var hdr Header
+	if err := hdr.UnmarshalBinary(raw); err != nil || string(hdr.Magic[:]) != "JUNK" {
+		t.Errorf("UnmarshalBinary of a bad magic = %q, %v", hdr.Magic, err)
+	}
+	if err := hdr.UnmarshalBinary(raw[:HeaderSize-1]); err == nil {
+		t.Error("UnmarshalBinary accepted a short header")
+	}
+}
+
+// TestDecodeUnknownSections decodes a file as a newer writer might lay it
+// out, with a region this version doesn't know between the GLB and the
+// particles and another after them, both covered by the checksum
+func TestDecodeUnknownSections(t *testing.T) {
+	want := testContainer()
+	var particles bytes.Buffer
+	binary.Write(&particles, binary.LittleEndian, want.Emitters)
+	unknown := bytes.Repeat([]byte{0xAB}, 40)
+	payload := slices.Concat(want.GLB, unknown, particles.Bytes(), unknown)
+
+	hdr := want.Header
+	copy(hdr.Magic[:], Magic)
+	hdr.Version = Version
+	hdr.SetParticles(true)
+	hdr.GLBOffset = HeaderSize
+	hdr.GLBSize = uint32(len(want.GLB))
+	hdr.ParticleOffset = HeaderSize + hdr.GLBSize + uint32(len(unknown))
+	hdr.ParticleSize = uint32(particles.Len())
+	hdr.Checksum = crc32.ChecksumIEEE(payload)
+	var buf bytes.Buffer
+	if err := writeHeader(&buf, binary.LittleEndian, &hdr); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(payload)
+	data := buf.Bytes()
+
+	_, glb, emitters, _, err := DecodeWithOptions(iotest.OneByteReader(bytes.NewReader(data)), DecodeOptions{VerifyChecksum: true})
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !bytes.Equal(glb, want.GLB) || !reflect.DeepEqual(emitters, want.Emitters) {
+		t.Errorf("Decode = %d-byte GLB, %d emitters, want %d, %d", len(glb), len(emitters), len(want.GLB), len(want.Emitters))
+	}
+	if _, glb, emitters, err = DecodeAt(bytes.NewReader(data), int64(len(data))); err != nil || !bytes.Equal(glb, want.GLB) || len(emitters) != len(want.Emitters) {
+		t.Errorf("DecodeAt = %d-byte GLB, %d emitters, %v", len(glb), len(emitters), err)
+	}
+}
+
+func TestDecodeEmitterAt(t *testing.T) {
+	c := testContainer()
+	c.Emitters = append(c.Emitters, c.Emitters[0])
+	c.Emitters[2].Position = [3]float32{7, 8, 9}
+	data := encodeTest(t, c)
+	r := bytes.NewReader(data)
+	hdr, err := DecodeHeader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, i := range []int{0, len(c.Emitters) - 1} {
+		e, err := DecodeEmitterAt(r, hdr, i)
+		if err != nil || e != c.Emitters[i] {
+			t.Errorf("DecodeEmitterAt(%d) = %+v, %v, want %+v", i, e, err, c.Emitters[i])
+		}
+	}
+	for _, i := range []int{-1, len(c.Emitters)} {
+		if _, err := DecodeEmitterAt(r, hdr, i); err == nil {
+			t.Errorf("DecodeEmitterAt(%d) succeeded", i)
+		}
+	}
+
+	// A file cut short inside the particle block
+	short := bytes.NewReader(data[:int(hdr.ParticleOffset)+EmitterSize+1])
+	if _, err := DecodeEmitterAt(short, hdr, 1); !errors.Is(err, ErrTruncated) {
+		t.Errorf("DecodeEmitterAt on a truncated file = %v, want ErrTruncated", err)
+	}
+
+	noParticles := *hdr
+	noParticles.SetParticles(false)
+	if _, err := DecodeEmitterAt(r, &noParticles, 0); err == nil {
+		t.Error("DecodeEmitterAt succeeded without particles")
+	}
+}
+
+func TestEmitterSeq(t *testing.T) {
+	c := testContainer()
+	data := encodeTest(t, c)
+	r := bytes.NewReader(data)
+	hdr, err := DecodeHeader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	for e, err := range hdr.EmitterSeq(r) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e != c.Emitters[n] {
+			t.Errorf("emitter %d = %+v, want %+v", n, e, c.Emitters[n])
+		}
+		n++
+	}
+	if n != len(c.Emitters) {
+		t.Errorf("iterated %d emitters, want %d", n, len(c.Emitters))
+	}
+
+	for range hdr.EmitterSeq(r) {
+		break // Stopping early must not panic
+	}
+
+	short := bytes.NewReader(data[:int(hdr.ParticleOffset)+EmitterSize+1])
+	var errs []error
+	for _, err := range hdr.EmitterSeq(short) {
+		errs = append(errs, err)
+	}
+	if len(errs) != 2 || errs[0] != nil || !errors.Is(errs[1], ErrTruncated) {
+		t.Errorf("EmitterSeq on a truncated file yielded %v, want nil then ErrTruncated", errs)
+	}
+}
+
+func TestEmitterJSONRoundTrip(t *testing.T) {
+	want := testContainer().Emitters
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadEmittersJSON(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip = %+v, want %+v", got, want)
+	}
+	if !bytes.Contains(data, []byte(`"easing":"easeInOut"`)) {
+		t.Errorf("easing not encoded by name: %s", data)
+	}
+
+	// Easing defaults to linear and must be a known name
+	got, err = ReadEmittersJSON(strings.NewReader(`[{"emissionRate": 1}]`))
+	if err != nil || got[0].Easing != EaseLinear {
+		t.Errorf("missing easing = %v, %v", got, err)
+	}
+	if _, err := ReadEmittersJSON(strings.NewReader(`[{"easing": "bounce"}]`)); err == nil {
+		t.Error("accepted an unknown easing")
+	}
+	if _, err := json.Marshal(ParticleEmitter{Easing: 9}); err == nil {
+		t.Error("marshaled an unknown easing")
+	}
+}
+
+func TestValidateNonFinite(t *testing.T) {
+	base := testContainer().Emitters[0]
+	if err := base.Validate(0); err != nil {
+		t.Fatalf("Validate of a good emitter: %v", err)
+	}
+
+	// Every float, in every field, must be finite
+	fields := 0
+	typ := reflect.TypeFor[ParticleEmitter]()
+	for i := range typ.NumField() {
+		f := typ.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		n := 1
+		switch {
+		case f.Type.Kind() == reflect.Array && f.Type.Elem().Kind() == reflect.Float32:
+			n = f.Type.Len()
+		case f.Type.Kind() != reflect.Float32:
+			continue
+		}
+		fields++
+		for j := range n {
+			for _, bad := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+				e := base
+				v := reflect.ValueOf(&e).Elem().Field(i)
+				if v.Kind() == reflect.Array {
+					v = v.Index(j)
+				}
+				v.SetFloat(bad)
+				if err := e.Validate(0); err == nil || !strings.Contains(err.Error(), "non-finite") {
+					t.Errorf("Validate with %s[%d] = %g: %v, want a non-finite error", f.Name, j, bad, err)
+				}
+			}
+		}
+	}
+	if fields < 15 {
+		t.Fatalf("found only %d float fields", fields)
+	}
+
+	// Encode names the bad emitter
+	emitters := []ParticleEmitter{base, base}
+	emitters[1].ParticleLifetime = float32(math.NaN())
+	err := Encode(io.Discard, &Header{}, testGLB(), emitters)
+	if err == nil || !strings.Contains(err.Error(), "emitter 1: non-finite") {
+		t.Errorf("Encode with a NaN lifetime = %v, want an error for emitter 1", err)
+	}
+
+	// Verify catches a NaN written by some other tool
+	c := testContainer()
+	data := encodeTest(t, c)
+	binary.LittleEndian.PutUint32(data[c.Header.ParticleOffset+24:], math.Float32bits(float32(math.NaN()))) // SpreadAngle
+	if err := Verify(bytes.NewReader(data), int64(len(data))); err == nil || !strings.Contains(err.Error(), "non-finite") {
+		t.Errorf("Verify of a NaN spread angle = %v, want a non-finite error", err)
+	}
+}
+
+func TestGravityVec(t *testing.T) {
+	c := testContainer()
+	if got := c.Emitters[0].Acceleration(); got != [3]float32{0, -9.8, 0} {
+		t.Errorf("scalar-only Acceleration = %v", got)
+	}
+	c.Emitters[1].GravityVec = [3]float32{1.5, -9.8, 0}
+
+	var got Container
+	if _, err := got.ReadFrom(bytes.NewReader(encodeTest(t, c))); err != nil {
+		t.Fatal(err)
+	}
+	if a := got.Emitters[1].Acceleration(); a != c.Emitters[1].GravityVec {
+		t.Errorf("decoded Acceleration = %v, want %v", a, c.Emitters[1].GravityVec)
+	}
+
+	// Only emitters with a vector mention it, so older readers' JSON is unchanged
+	data, err := json.Marshal(c.Emitters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(data, []byte(`"gravityVec":[1.5,-9.8,0]`)); n != 1 || bytes.Count(data, []byte("gravityVec")) != 1 {
+		t.Errorf("gravityVec encoded for the wrong emitters: %s", data)
+	}
+	decoded, err := ReadEmittersJSON(bytes.NewReader(data))
+	if err != nil || !reflect.DeepEqual(decoded, c.Emitters) {
+		t.Errorf("JSON round trip = %+v, %v", decoded, err)
+	}
+
+	e := c.Emitters[1]
+	e.GravityVec[0] = float32(math.Inf(1))
+	if err := e.Validate(0); err == nil {
+		t.Error("accepted an infinite gravity vector")
+	}
+}
+
+func TestAtlasRect(t *testing.T) {
+	c := testContainer()
+	if got := c.Emitters[0].UVRect(); got != [4]float32{0, 0, 1, 1} {
+		t.Errorf("default UVRect = %v", got)
+	}
+
+	// Without rects the file stays version 1 for older readers
+	v1 := encodeTest(t, c)
+	if hdr, err := DecodeHeader(bytes.NewReader(v1)); err != nil || hdr.Version != 1 || hdr.ParticleSize != uint32(2*EmitterSize) {
+		t.Fatalf("encoded without rects as %+v, %v", hdr, err)
+	}
+
+	c.Emitters[1].AtlasRect = [4]float32{0.5, 0, 1, 0.25}
+	data := encodeTest(t, c)
+	hdr, err := DecodeHeader(bytes.NewReader(data))
+	if err != nil || hdr.Version != 2 || hdr.ParticleSize != uint32(2*EmitterSizeV2) {
+		t.Fatalf("encoded with a rect as %+v, %v", hdr, err)
+	}
+	var got Container
+	if _, err := got.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Emitters, c.Emitters) {
+		t.Errorf("decoded %+v, want %+v", got.Emitters, c.Emitters)
+	}
+	if e, err := DecodeEmitterAt(bytes.NewReader(data), hdr, 1); err != nil || e.UVRect() != c.Emitters[1].AtlasRect {
+		t.Errorf("DecodeEmitterAt = %v, %v", e.AtlasRect, err)
+	}
+
+	data, err = json.Marshal(c.Emitters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Count(data, []byte(`"atlasRect":[0.5,0,1,0.25]`)) != 1 || bytes.Count(data, []byte("atlasRect")) != 1 {
+		t.Errorf("atlasRect encoded for the wrong emitters: %s", data)
+	}
+	decoded, err := ReadEmittersJSON(bytes.NewReader(data))
+	if err != nil || !reflect.DeepEqual(decoded, c.Emitters) {
+		t.Errorf("JSON round trip = %+v, %v", decoded, err)
+	}
+
+	for _, r := range [][4]float32{{0, 0, 1.5, 1}, {-0.1, 0, 1, 1}, {0.5, 0, 0.5, 1}, {0, 1, 1, 0}} {
+		e := c.Emitters[1]
+		e.AtlasRect = r
+		if err := e.Validate(0); err == nil {
+			t.Errorf("accepted atlas rect %v", r)
+		}
+	}
+}
+
+func TestSeed(t *testing.T) {
+	c := testContainer()
+	c.Emitters[0].Seed = 7
+	data := encodeTest(t, c)
+	hdr, err := DecodeHeader(bytes.NewReader(data))
+	if err != nil || hdr.Version != 3 || hdr.ParticleSize != uint32(2*EmitterSizeV3) {
+		t.Fatalf("encoded with a seed as %+v, %v", hdr, err)
+	}
+	var got Container
+	if _, err := got.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Emitters, c.Emitters) {
+		t.Errorf("decoded %+v, want %+v", got.Emitters, c.Emitters)
+	}
+	var seeds []uint32
+	for e, err := range hdr.EmitterSeq(bytes.NewReader(data)) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		seeds = append(seeds, e.Seed)
+	}
+	if !slices.Equal(seeds, []uint32{7, 0}) {
+		t.Errorf("EmitterSeq seeds = %v", seeds)
+	}
+
+	data, err = json.Marshal(c.Emitters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Count(data, []byte(`"seed":7`)) != 1 || bytes.Count(data, []byte(`"seed"`)) != 1 {
+		t.Errorf("seed encoded for the wrong emitters: %s", data)
+	}
+	decoded, err := ReadEmittersJSON(bytes.NewReader(data))
+	if err != nil || !reflect.DeepEqual(decoded, c.Emitters) {
+		t.Errorf("JSON round trip = %+v, %v", decoded, err)
+	}
+}
+
+func TestFlipbook(t *testing.T) {
+	c := testContainer()
+	c.Textures = []Texture{{Name: "smoke"}, {Name: "fire0", Data: []byte("0")}, {Name: "fire1", Data: []byte("1")}}
+	c.Emitters[0].TextureIndex = 1
+	c.Emitters[0].FrameCount = 2
+	c.Emitters[0].FPS = 12
+	data := encodeTest(t, c)
+	hdr, err := DecodeHeader(bytes.NewReader(data))
+	if err != nil || hdr.Version != 4 || hdr.ParticleSize != uint32(2*EmitterSizeV4) {
+		t.Fatalf("encoded with a flipbook as %+v, %v", hdr, err)
+	}
+	var got Container
+	if _, err := got.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Emitters, c.Emitters) {
+		t.Errorf("decoded %+v, want %+v", got.Emitters, c.Emitters)
+	}
+
+	data, err = json.Marshal(got.Emitters[0])
+	if err != nil || !bytes.Contains(data, []byte(`"fps":12,"frameCount":2`)) {
+		t.Errorf("JSON = %s, %v", data, err)
+	}
+	var decoded ParticleEmitter
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded != c.Emitters[0] {
+		t.Errorf("JSON round trip = %+v, %v", decoded, err)
+	}
+
+	for _, tt := range []struct {
+		index  int32
+		frames uint8
+		fps    float32
+	}{
+		{1, 3, 12},  // One frame past the table
+		{-1, 2, 12}, // Default spark can't animate
+		{1, 2, -1},
+	} {
+		e := c.Emitters[0]
+		e.TextureIndex, e.FrameCount, e.FPS = tt.index, tt.frames, tt.fps
+		if err := e.Validate(len(c.Textures)); err == nil {
+			t.Errorf("accepted %d frames from %d at %g fps", tt.frames, tt.index, tt.fps)
+		}
+	}
+}
+
+func TestEncoderAtlasRect(t *testing.T) {
+	c := testContainer()
+	c.Emitters[0].AtlasRect = [4]float32{0, 0, 0.5, 0.5}
+
+	// A sized Encoder can't change the version once the header is out
+	hdr := c.Header
+	hdr.GLBSize = uint32(len(c.GLB))
+	hdr.ParticleSize = uint32(EncodedParticleSize(c.Emitters))
+	e := NewEncoder(io.Discard)
+	if err := e.WriteHeader(&hdr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.WriteGLB(bytes.NewReader(c.GLB)); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.WriteEmitters(c.Emitters); err == nil {
+		t.Error("sized version 1 Encoder wrote atlas rects")
+	}
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "atlas.ntsm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	hdr = c.Header
+	if err := EncodeStream(f, &hdr, bytes.NewReader(c.GLB), c.Emitters); err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Version != 2 {
+		t.Errorf("EncodeStream wrote version %d", hdr.Version)
+	}
+	f.Seek(0, io.SeekStart)
+	var got Container
+	if _, err := got.ReadFrom(f); err != nil || got.Emitters[0].AtlasRect != c.Emitters[0].AtlasRect {
+		t.Errorf("decoded %v, %v", got.Emitters, err)
+	}
+}
+
+func TestEasing(t *testing.T) {
+	for e := range Easing(len(easingNames)) {
+		if got, err := ParseEasing(e.String()); err != nil || got != e {
+			t.Errorf("ParseEasing(%q) = %v, %v", e.String(), got, err)
+		}
+		if e.Apply(0) != 0 || e.Apply(1) != 1 || e.Apply(-1) != 0 || e.Apply(2) != 1 {
+			t.Errorf("%v doesn't run from 0 to 1", e)
+		}
+	}
+	for _, tt := range []struct {
+		e    Easing
+		want float32
+	}{
+		{EaseLinear, 0.25}, {EaseIn, 0.0625}, {EaseOut, 0.4375}, {EaseInOut, 0.125},
+	} {
+		if got := tt.e.Apply(0.25); got != tt.want {
+			t.Errorf("%v.Apply(0.25) = %g, want %g", tt.e, got, tt.want)
+		}
+	}
+
+	e := ParticleEmitter{Easing: 4, TextureIndex: -1}
+	if err := e.Validate(0); err == nil {
+		t.Error("Validate accepted an unknown easing")
+	}
+}
+
+func TestClone(t *testing.T) {
+	if CloneEmitters(nil) != nil {
+		t.Error("CloneEmitters(nil) is not nil")
+	}
+	emitters := testContainer().Emitters
+	cloned := CloneEmitters(emitters)
+	cloned[0].EmissionRate = 99
+	if emitters[0].EmissionRate == 99 {
+		t.Error("CloneEmitters shares the backing array")
+	}
+
+	for _, copyData := range []bool{false, true} {
+		c := testContainer()
+		c.Textures = []Texture{{Name: "spark", MimeType: "image/png", Data: []byte("png")}}
+		c.Meshes = []GLBEntry{{Name: "high", Data: testGLB()}, {Name: "low", Data: testGLB(), LODDistance: 10}}
+		c.SetMeta("author", "netisu")
+		c.SetThumbnail([]byte("\x89PNG thumb"))
+		want := c.Clone(true) // Snapshot to compare against
+
+		clone := c.Clone(copyData)
+		if !reflect.DeepEqual(clone, c) {
+			t.Fatalf("copyData %v: clone differs from the original", copyData)
+		}
+
+		// Fields and slices are always the clone's own
+		clone.Header.SetName("edited")
+		clone.Emitters[0].EmissionRate = 99
+		clone.Emitters = append(clone.Emitters, ParticleEmitter{})
+		clone.Textures[0].Name = "edited"
+		clone.Meshes[1].LODDistance = 99
+		clone.SetMeta("author", "edited")
+		if c.Header != want.Header || !reflect.DeepEqual(c.Emitters, want.Emitters) || c.Textures[0].Name != "spark" ||
+			c.Meshes[1].LODDistance != 10 || c.Meta()["author"] != "netisu" {
+			t.Errorf("copyData %v: editing the clone changed the original", copyData)
+		}
+
+		// Byte data is shared unless copyData is set
+		clone.GLB[0] ^= 0xff
+		clone.Textures[0].Data[0] ^= 0xff
+		clone.Meshes[0].Data[0] ^= 0xff
+		clone.thumbnail[0] ^= 0xff
+		for _, tt := range []struct {
+			name      string
+			got, want []byte
+		}{
+			{"GLB", c.GLB, want.GLB},
+			{"texture", c.Textures[0].Data, want.Textures[0].Data},
+			{"mesh", c.Meshes[0].Data, want.Meshes[0].Data},
+			{"thumbnail", c.thumbnail, want.thumbnail},
+		} {
+			if shared := !bytes.Equal(tt.got, tt.want); shared == copyData {
+				t.Errorf("copyData %v: %s shared = %v", copyData, tt.name, shared)
+			}
+		}
+	}
+}
+
+func TestSetEmitterTexture(t *testing.T) {
+	c := testContainer()
+	c.Textures = []Texture{
+		{Name: "smoke.png", MimeType: "image/png", Data: []byte("smoke")},
+		{Name: "spark.png", MimeType: "image/png", Data: []byte("spark")},
+	}
+
+	if err := c.SetEmitterTexture(1, "spark.png"); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Emitters[1].TextureIndex; got != 1 {
+		t.Errorf("TextureIndex = %d, want 1", got)
+	}
+
+	if err := c.SetEmitterTexture(0, "fire.png"); err == nil {
+		t.Error("SetEmitterTexture with an unknown name succeeded")
+	}
+	if got := c.Emitters[0].TextureIndex; got != -1 {
+		t.Errorf("TextureIndex = %d after a failed lookup, want -1", got)
+	}
+	if err := c.SetEmitterTexture(len(c.Emitters), "spark.png"); err == nil {
+		t.Error("SetEmitterTexture with an out-of-range emitter succeeded")
+	}
+}
+
+func TestSortEmitters(t *testing.T) {
+	c := testContainer()
+	c.Textures = []Texture{{Name: "smoke"}, {Name: "spark"}}
+	for i, tex := range []int32{1, 0, -1, 1, 0} {
+		c.Emitters = append(c.Emitters, ParticleEmitter{TextureIndex: tex, GroupID: uint16(i)})
+	}
+	c.SortEmitters(func(a, b ParticleEmitter) bool { return a.TextureIndex < b.TextureIndex })
+
+	var got Container
+	if _, err := got.ReadFrom(bytes.NewReader(encodeTest(t, c))); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Emitters, c.Emitters) {
+		t.Fatalf("order changed in a round trip: %+v", got.Emitters)
+	}
+	// Ties keep their order: the default spark (both test emitters and group 2),
+	// then smoke (groups 1 and 4), then spark (groups 0 and 3)
+	var order []uint16
+	for _, e := range got.Emitters {
+		order = append(order, e.GroupID)
+	}
+	if want := []uint16{7, 0, 2, 1, 4, 0, 3}; !slices.Equal(order, want) {
+		t.Errorf("sorted group IDs %v, want %v", order, want)
+	}
+}
+
+func TestDecodeFramed(t *testing.T) {
+	a, b := testContainer(), testContainer()
+	b.Emitters = nil
+	b.SetMeta("author", "netisu")
+
+	var stream bytes.Buffer
+	for _, c := range []*Container{a, b} {
+		if err := EncodeFramed(&stream, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := slices.Clone(stream.Bytes())
+
+	// A plain io.Reader, as from a socket, with no way to seek
+	r := io.MultiReader(&stream)
+	for i, want := range []*Container{a, b} {
+		got, err := DecodeFramed(r)
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		checkDecoded(t, want, &got.Header, got.GLB, got.Emitters)
+	}
+	if got, err := DecodeFramed(r); err != io.EOF {
+		t.Errorf("after the last frame got %v, %v, want io.EOF", got, err)
+	}
+
+	r = bytes.NewReader(data[:len(data)-1])
+	if _, err := DecodeFramed(r); err != nil {
+		t.Fatalf("first frame of a cut stream: %v", err)
+	}
+	if _, err := DecodeFramed(r); !errors.Is(err, ErrTruncated) {
+		t.Errorf("cut frame decoded with %v, want ErrTruncated", err)
+	}
+	if _, err := DecodeFramed(bytes.NewReader(encodeTest(t, a))); err == nil {
+		t.Error("unframed file decoded as a frame")
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	c := testContainer()
+	c.Textures = []Texture{{Name: "spark", Data: []byte("png")}, {Name: "smoke", Data: []byte("png!")}}
+	data := encodeTest(t, c)
+	var compressed bytes.Buffer
+	if err := EncodeWithOptions(&compressed, &Header{}, c.GLB, nil, nil, EncodeOptions{Compression: CompressionDeflate}); err != nil {
+		t.Fatal(err)
+	}
+
+	lod := testContainer()
+	lod.Meshes = []GLBEntry{{Name: "near", Data: lod.GLB}, {Name: "far", Data: lod.GLB, LODDistance: 50}}
+	lodData := encodeTest(t, lod)
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+		opts DecodeOptions
+	}{
+		{"GLB", data, DecodeOptions{MaxGLBSize: int64(len(c.GLB)) - 1}},
+		{"levels of detail", lodData, DecodeOptions{VerifyChecksum: true, MaxGLBSize: int64(2*len(c.GLB)) - 1}},
+		{"decompressed GLB", compressed.Bytes(), DecodeOptions{MaxGLBSize: int64(len(c.GLB)) - 1}},
+		{"particles", data, DecodeOptions{MaxParticleBytes: int64(EncodedParticleSize(c.Emitters)) - 1}},
+		{"textures", data, DecodeOptions{MaxTextureBytes: 6}},
+	} {
+		if _, _, _, _, err := DecodeWithOptions(bytes.NewReader(tt.data), tt.opts); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("%s over the limit decoded with %v, want ErrTooLarge", tt.name, err)
+		}
+	}
+
+	// Limits at the sizes, or on skipped sections, don't trip
+	for _, opts := range []DecodeOptions{
+		{MaxGLBSize: int64(len(c.GLB)), MaxParticleBytes: int64(EncodedParticleSize(c.Emitters)), MaxTextureBytes: 7},
+		{SkipGLB: true, SkipParticles: true, MaxGLBSize: 1, MaxParticleBytes: 1},
+	} {
+		if _, _, _, _, err := DecodeWithOptions(bytes.NewReader(data), opts); err != nil {
+			t.Errorf("decoding with %+v: %v", opts, err)
+		}
+	}
+	// Without verification only the first level of detail is read
+	if _, _, _, _, err := DecodeWithOptions(bytes.NewReader(lodData), DecodeOptions{MaxGLBSize: int64(len(c.GLB))}); err != nil {
+		t.Errorf("decoding the first level of detail: %v", err)
+	}
+
+	// Raw sizes in uncompressed files are ignored, whatever they hold
+	junk := withHeader(t, data, func(h *Header) { h.GLBRawSize = math.MaxUint32 })
+	if _, glb, _, _, err := DecodeWithOptions(bytes.NewReader(junk), DecodeOptions{MaxGLBSize: int64(len(c.GLB))}); err != nil || !bytes.Equal(glb, c.GLB) {
+		t.Errorf("uncompressed GLB with a junk raw size decoded with %v", err)
+	}
+	junk = slices.Clone(lodData)
+	for i := range len(lod.Meshes) {
+		at := int64(lod.Header.MeshTableOffset) + 4 + int64(i)*meshEntrySize + 72 // MeshEntry.RawSize
+		binary.LittleEndian.PutUint32(junk[at:], math.MaxUint32)
+	}
+	if _, _, _, _, err := DecodeWithOptions(bytes.NewReader(junk), DecodeOptions{MaxGLBSize: int64(2 * len(c.GLB))}); err != nil {
+		t.Errorf("uncompressed levels of detail with junk raw sizes decoded with %v", err)
+	}
+}
+
+func TestRemoveParticles(t *testing.T) {
+	var c Container
+	if _, err := c.ReadFrom(bytes.NewReader(encodeTest(t, testContainer()))); err != nil {
+		t.Fatal(err)
+	}
+	c.RemoveParticles()
+
+	data := encodeTest(t, &c)
+	var got Container
+	if _, err := got.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if got.Emitters != nil || got.Header.HasParticles() || got.Header.ParticleSize != 0 {
+		t.Errorf("particles left after removal: %d emitters, header %+v", len(got.Emitters), got.Header)
+	}
+	if !bytes.Equal(got.GLB, testContainer().GLB) {
+		t.Error("GLB changed")
+	}
+}
+
+func TestSetGLB(t *testing.T) {
+	c := testContainer()
+	c.Textures = []Texture{{Name: "spark", MimeType: "image/png", Data: []byte("png")}}
+	c.SetMeta("author", "netisu")
+	c.SetThumbnail([]byte("\x89PNG thumb"))
+
+	var decoded Container
+	if _, err := decoded.ReadFrom(bytes.NewReader(encodeTest(t, c))); err != nil {
+		t.Fatal(err)
+	}
+	oldParticles := decoded.Header.ParticleOffset
+
+	// A larger GLB moves every section after it
+	glb := testGLB()
+	glb = append(glb, bytes.Repeat([]byte(" "), 100)...)
+	binary.LittleEndian.PutUint32(glb[8:], uint32(len(glb)))
+	binary.LittleEndian.PutUint32(glb[12:], uint32(len(glb)-20))
+	decoded.SetGLB(glb)
+	if decoded.Stats().FileSize != 0 {
+		t.Error("Stats still reports the old file size")
+	}
+
+	data := encodeTest(t, &decoded)
+	if err := Verify(bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if decoded.Header.ParticleOffset != oldParticles+100 {
+		t.Errorf("ParticleOffset = %d, want %d", decoded.Header.ParticleOffset, oldParticles+100)
+	}
+
+	var got Container
+	if _, err := got.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.GLB, glb) || !reflect.DeepEqual(got.Emitters, c.Emitters) || !reflect.DeepEqual(got.Textures, c.Textures) {
+		t.Error("GLB, emitters or textures differ after the swap")
+	}
+	if thumb, _ := got.Thumbnail(); !bytes.Equal(thumb, []byte("\x89PNG thumb")) || got.Meta()["author"] != "netisu" {
+		t.Error("thumbnail or metadata lost after the swap")
+	}
+
+	// In a multi-mesh container the first level is replaced
+	lod := testContainer()
+	lod.Meshes = []GLBEntry{{Name: "high", Data: testGLB()}, {Name: "low", Data: testGLB()}}
+	lod.SetGLB(glb)
+	got = Container{}
+	if _, err := got.ReadFrom(bytes.NewReader(encodeTest(t, lod))); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Meshes[0].Data, glb) || !bytes.Equal(got.Meshes[1].Data, testGLB()) {
+		t.Error("SetGLB didn't replace only the first mesh")
+	}
+}
+
+func TestGLBExtensions(t *testing.T) {
+	draco, err := os.ReadFile("tests/glb/draco.glb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exts, err := GLBExtensions(draco)
+	if err != nil || !reflect.DeepEqual(exts, []string{ExtDracoMeshCompression}) {
+		t.Errorf("GLBExtensions(draco.glb) = %q, %v", exts, err)
+	}
+	if ext, err := CompressedGeometry(draco); ext != ExtDracoMeshCompression || err != nil {
+		t.Errorf("CompressedGeometry(draco.glb) = %q, %v", ext, err)
+	}
+
+	meshopt := testGLBJSON(`{"asset":{"version":"2.0"},"extensionsUsed":["KHR_materials_unlit","EXT_meshopt_compression"],"extensionsRequired":["EXT_meshopt_compression","KHR_mesh_quantization"]}`)
+	exts, err = GLBExtensions(meshopt)
+	if want := []string{"KHR_materials_unlit", ExtMeshoptCompression, "KHR_mesh_quantization"}; err != nil || !reflect.DeepEqual(exts, want) {
+		t.Errorf("GLBExtensions = %q, %v, want %q", exts, err, want)
+	}
+	if ext, _ := CompressedGeometry(meshopt); ext != ExtMeshoptCompression {
+		t.Errorf("CompressedGeometry = %q, want %s", ext, ExtMeshoptCompression)
+	}
+
+	if exts, err := GLBExtensions(testGLB()); exts != nil || err != nil {
+		t.Errorf("GLBExtensions of a plain GLB = %q, %v", exts, err)
+	}
+	if ext, err := CompressedGeometry(testGLB()); ext != "" || err != nil {
+		t.Errorf("CompressedGeometry of a plain GLB = %q, %v", ext, err)
+	}
+	if _, err := GLBExtensions(testGLBJSON(`{"extensionsUsed":`)); !errors.Is(err, ErrInvalidGLB) {
+		t.Errorf("GLBExtensions with bad JSON = %v, want ErrInvalidGLB", err)
+	}
+}
+
+func TestEmitterGroups(t *testing.T) {
+	fire := ParticleEmitter{EmissionRate: 30, TextureIndex: -1, GroupID: 1}
+	smoke := ParticleEmitter{EmissionRate: 5, TextureIndex: -1, GroupID: 1, BlendMode: BlendAlpha}
+	sparkle := ParticleEmitter{EmissionRate: 2, TextureIndex: -1}
+	c := &Container{GLB: testGLB(), Emitters: []ParticleEmitter{fire, sparkle, smoke}}
+
+	var got Container
+	if _, err := got.ReadFrom(bytes.NewReader(encodeTest(t, c))); err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint16][]ParticleEmitter{0: {sparkle}, 1: {fire, smoke}}
+	if groups := got.EmitterGroups(); !reflect.DeepEqual(groups, want) {
+		t.Errorf("EmitterGroups = %+v, want %+v", groups, want)
+	}
+	if groups := (&Container{}).EmitterGroups(); groups != nil {
+		t.Errorf("EmitterGroups with no emitters = %+v", groups)
+	}
+}
+
+func TestSniff(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"item.asset", encodeTest(t, testContainer()), true},
+		{"item.ntsm", testGLB(), false},
+		{"short.ntsm", []byte("NTS"), false},
+		{"empty", nil, false},
+	} {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, tt.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Sniff(f)
+		f.Close()
+		if got != tt.want || err != nil {
+			t.Errorf("Sniff(%s) = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestOpenGLB(t *testing.T) {
+	c := testContainer()
+	data := encodeTest(t, c)
+	r := bytes.NewReader(data)
+
+	sr, err := OpenGLB(r, &c.Header)
+	if err != nil {
+		t.Fatalf("OpenGLB: %v", err)
+	}
+	if sr.Size() != int64(len(c.GLB)) {
+		t.Errorf("section size = %d, want %d", sr.Size(), len(c.GLB))
+	}
+	if glb, err := io.ReadAll(sr); err != nil || !bytes.Equal(glb, c.GLB) {
+		t.Errorf("section = %q, %v, want %q", glb, err, c.GLB)
+	}
+	// Reads stop at the end of the GLB, not the end of the file
+	if n, err := sr.ReadAt(make([]byte, 4), sr.Size()-2); n != 2 || err != io.EOF {
+		t.Errorf("ReadAt across the end = %d, %v, want 2, EOF", n, err)
+	}
+	if pos, err := sr.Seek(-4, io.SeekEnd); err != nil || pos != sr.Size()-4 {
+		t.Errorf("Seek from the end = %d, %v", pos, err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		edit func(*Header)
+	}{
+		{"offset in the header", func(h *Header) { h.GLBOffset = HeaderSize - 1 }},
+		{"offset past EOF", func(h *Header) { h.GLBOffset = uint32(len(data)) + 1 }},
+		{"size past EOF", func(h *Header) { h.GLBSize = uint32(len(data)) }},
+		{"compressed", func(h *Header) { h.SetCompressed(true) }},
+	} {
+		hdr := c.Header
+		tt.edit(&hdr)
+		if sr, err := OpenGLB(r, &hdr); err == nil {
+			t.Errorf("%s: OpenGLB = section of %d bytes, want an error", tt.name, sr.Size())
+		}
+	}
+}
+
+func TestOpenValidatedGLB(t *testing.T) {
+	open := func(data []byte) ([]byte, error) {
+		hdr, err := DecodeHeader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hdr.OpenValidatedGLB(bytes.NewReader(data))
+	}
+
+	valid, err := os.ReadFile("tests/glb/valid.ntsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if glb, err := open(valid); err != nil || validateGLB(glb) != nil {
+		t.Errorf("valid.ntsm: %v", err)
+	}
+	corrupt, err := os.ReadFile("tests/glb/corrupt-glb.ntsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := open(corrupt); !errors.Is(err, ErrInvalidGLB) {
+		t.Errorf("corrupt-glb.ntsm = %v, want ErrInvalidGLB", err)
+	}
+
+	c := testContainer()
+	var buf bytes.Buffer
+	if err := EncodeWithOptions(&buf, &c.Header, c.GLB, c.Emitters, nil, EncodeOptions{Compression: CompressionDeflate}); err != nil {
+		t.Fatal(err)
+	}
+	compressed := buf.Bytes()
+	if glb, err := open(compressed); err != nil || !bytes.Equal(glb, c.GLB) {
+		t.Errorf("compressed GLB = %q, %v, want %q", glb, err, c.GLB)
+	}
+
+	// A changed emitter leaves the GLB sound but breaks the checksum
+	bad := slices.Clone(compressed)
+	bad[c.Header.ParticleOffset] ^= 0xff
+	if _, err := open(bad); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("corrupt particles = %v, want ErrChecksumMismatch", err)
+	}
+
+	short := compressed[:c.Header.GLBOffset+c.Header.GLBSize-1]
+	if _, err := open(short); !errors.Is(err, ErrTruncated) {
+		t.Errorf("truncated compressed GLB = %v, want ErrTruncated", err)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	data, err := os.ReadFile("tests/glb/corrupt-header.ntsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Verify(bytes.NewReader(data), int64(len(data))) == nil {
+		t.Fatal("fixture verifies; its header should be corrupt")
+	}
+
+	c, err := Repair(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateGLB(c.GLB); err != nil {
+		t.Errorf("recovered GLB: %v", err)
+	}
+	if len(c.Emitters) != 1 || c.Emitters[0].TextureIndex != 0 {
+		t.Errorf("recovered emitters %+v, want one using texture 0", c.Emitters)
+	}
+	if len(c.Textures) != 1 || c.Textures[0].Name != "spark.png" {
+		t.Errorf("recovered textures %+v, want spark.png", c.Textures)
+	}
+	if got := c.Meta()["author"]; got != "netisu" {
+		t.Errorf("recovered author %q, want netisu", got)
+	}
+
+	repaired := encodeTest(t, c)
+	if err := Verify(bytes.NewReader(repaired), int64(len(repaired))); err != nil {
+		t.Errorf("repaired file doesn't verify: %v", err)
+	}
+
+	if _, err := Repair(bytes.NewReader(data[:HeaderSize]), HeaderSize); err == nil {
+		t.Error("Repair of a file with no GLB succeeded")
+	}
+}
+
+// unseekable is a writer whose Seek always fails, like a pipe
+type unseekable struct{ io.Writer }
+
+func (unseekable) Seek(int64, int) (int64, error) { return 0, errors.New("illegal seek") }
+
+func TestContainerWriter(t *testing.T) {
+	want := testContainer()
+	write := func(close bool) []byte {
+		t.Helper()
+		f, err := os.Create(filepath.Join(t.TempDir(), "item.ntsm"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		hdr := want.Header
+		cw, err := NewContainerWriter(f, &hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		glb := want.GLB
+		for len(glb) > 0 {
+			n := min(len(glb), 7)
+			if _, err := cw.Write(glb[:n]); err != nil {
+				t.Fatal(err)
+			}
+			glb = glb[n:]
+		}
+		if err := cw.WriteEmitters(want.Emitters); err != nil {
+			t.Fatal(err)
+		}
+		if close {
+			if err := cw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := cw.Write([]byte("x")); err == nil {
+				t.Error("Write after Close succeeded")
+			}
+			if hdr.GLBSize != uint32(len(want.GLB)) || hdr.Checksum == 0 {
+				t.Errorf("header not updated on Close: %+v", hdr)
+			}
+		}
+		data, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	data := write(true)
+	if err := Verify(bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	_, glb, emitters, err := Decode(bytes.NewReader(data))
+	if err != nil || !bytes.Equal(glb, want.GLB) || !reflect.DeepEqual(emitters, want.Emitters) {
+		t.Errorf("Decode = %d-byte GLB, %d emitters, %v", len(glb), len(emitters), err)
+	}
+
+	// Without Close the header's magic is still zero
+	data = write(false)
+	if err := Verify(bytes.NewReader(data), int64(len(data))); !errors.Is(err, ErrBadMagic) {
+		t.Errorf("Verify of a file written without Close = %v, want ErrBadMagic", err)
+	}
+	if ok, _ := Sniff(bytes.NewReader(data)); ok {
+		t.Error("Sniff recognizes a file written without Close")
+	}
+
+	if _, err := NewContainerWriter(unseekable{io.Discard}, &Header{}); err == nil {
+		t.Error("NewContainerWriter accepted an unseekable writer")
+	}
+}
+
+// TestCoreDependencies builds the core package alone in a module that
+// requires nothing, so an import of aeno, or of anything else outside the
+// standard library, fails here rather than in a size-sensitive consumer. It
+// is also built for GOOS=js, where the browser decodes with DecodeBytes
+func TestCoreDependencies(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs the go command")
+	}
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+
+	dir := t.TempDir()
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if strings.HasSuffix(f, "_test.go") {
+			continue
+		}
+		data, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, f), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module github.com/netisu/ntsm\n\ngo 1.25.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, target := range [][]string{nil, {"GOOS=js", "GOARCH=wasm"}} {
+		cmd := exec.Command(goCmd, "build", ".")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=-mod=mod", "GOPROXY=off")
+		cmd.Env = append(cmd.Env, target...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("core package doesn't build without dependencies %v: %v\n%s", target, err, out)
+		}
+	}
+}
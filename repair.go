@@ -0,0 +1,138 @@
+package ntsm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"unicode/utf8"
+)
+
+// Repair recovers what it can from the size-byte file in r when its header
+// is corrupt but the payload is intact, returning a container that WriteTo
+// encodes with a fresh header. The heuristics are:
+//
+//   - The GLB is the first well-formed GLB after the header, found by
+//     scanning for its "glTF" magic and sized by its own length field
+//   - The name and byte order are kept from the old header when plausible
+//   - Emitters, textures, metadata and the thumbnail are kept only when the
+//     old header's fields for them still describe well-formed data. Emitters
+//     are also looked for right after the GLB, where the encoder puts them
+//   - Emitters pointing at a texture that couldn't be recovered fall back to
+//     the default spark
+//
+// A compressed GLB has no magic to find, so it can't be recovered, nor can
+// emitters whose has_particles flag or particle size was lost. Only the
+// first level of detail of a multi-mesh file is kept
+func Repair(r io.ReaderAt, size int64) (*Container, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(io.NewSectionReader(r, 0, size), data); err != nil {
+		return nil, truncated(err)
+	}
+
+	glbStart, glbEnd := findGLB(data)
+	if glbStart < 0 {
+		return nil, errors.New("ntsm: repair: no intact GLB found")
+	}
+
+	var old Header
+	if len(data) >= HeaderSize {
+		binary.Read(bytes.NewReader(data[:HeaderSize]), ByteOrder(data[byteOrderOffset]).binary(), &old)
+	}
+	c := &Container{GLB: data[glbStart:glbEnd]}
+	if old.ByteOrder.valid() {
+		c.Header.ByteOrder = old.ByteOrder
+	}
+	if name := cString(old.Name[:]); utf8.ValidString(name) {
+		putCString(c.Header.Name[:], name)
+	}
+	old.ByteOrder = c.Header.ByteOrder
+
+	in := func(offset, n uint32) bool {
+		return offset >= HeaderSize && int64(offset)+int64(n) <= size
+	}
+	c.Textures = repairTextures(data, &old, in)
+
+	if old.HasParticles() && old.ParticleSize > 0 && old.ParticleSize%uint32(emitterSize(old.Version)) == 0 {
+		for _, offset := range []int64{int64(old.ParticleOffset), glbEnd} {
+			if offset > math.MaxUint32 || !in(uint32(offset), old.ParticleSize) {
+				continue
+			}
+			emitters, err := decodeEmitters(data[offset:offset+int64(old.ParticleSize)], old.ByteOrder, old.Version)
+			if err != nil || validateEmitters(emitters, math.MaxInt32) != nil {
+				continue
+			}
+			for i := range emitters {
+				if int(emitters[i].TextureIndex)+emitters[i].Frames() > len(c.Textures) {
+					emitters[i].TextureIndex = -1
+					emitters[i].FrameCount = 0
+				}
+			}
+			c.Emitters = emitters
+			break
+		}
+	}
+
+	if old.HasMeta() && in(old.MetaOffset, old.MetaSize) {
+		if meta, err := decodeMeta(data[old.MetaOffset:old.MetaOffset+old.MetaSize], old.ByteOrder); err == nil {
+			c.meta = meta
+		}
+	}
+	if old.HasThumbnail() && in(old.ThumbnailOffset, old.ThumbnailSize) {
+		if thumb := data[old.ThumbnailOffset : old.ThumbnailOffset+old.ThumbnailSize]; bytes.HasPrefix(thumb, []byte("\x89PNG")) {
+			c.thumbnail = thumb
+		}
+	}
+	return c, nil
+}
+
+// findGLB returns the bounds of the first well-formed GLB after the header,
+// or -1 if there is none
+func findGLB(data []byte) (start, end int64) {
+	for i := HeaderSize; i < len(data); {
+		j := bytes.Index(data[i:], []byte("glTF"))
+		if j < 0 {
+			break
+		}
+		start = int64(i + j)
+		if start+12 <= int64(len(data)) {
+			end = start + int64(binary.LittleEndian.Uint32(data[start+8:]))
+			if end <= int64(len(data)) && validateGLB(data[start:end]) == nil {
+				return start, end
+			}
+		}
+		i += j + 1
+	}
+	return -1, -1
+}
+
+// repairTextures returns the textures described by the old header, or nil
+// if its table or any entry is out of bounds
+func repairTextures(data []byte, old *Header, in func(offset, n uint32) bool) []Texture {
+	if old.TextureCount == 0 || int64(old.TextureCount)*textureEntrySize > int64(len(data)) {
+		return nil
+	}
+	tableSize := old.TextureCount * uint32(textureEntrySize)
+	if !in(old.TextureOffset, tableSize) {
+		return nil
+	}
+	entries := make([]TextureEntry, old.TextureCount)
+	table := data[old.TextureOffset : old.TextureOffset+tableSize]
+	if binary.Read(bytes.NewReader(table), old.ByteOrder.binary(), entries) != nil {
+		return nil
+	}
+
+	textures := make([]Texture, len(entries))
+	for i, e := range entries {
+		if !in(e.Offset, e.Size) {
+			return nil
+		}
+		textures[i] = Texture{
+			Name:     cString(e.Name[:]),
+			MimeType: cString(e.MimeType[:]),
+			Data:     data[e.Offset : e.Offset+e.Size],
+		}
+	}
+	return textures
+}
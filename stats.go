@@ -0,0 +1,49 @@
+package ntsm
+
+import "fmt"
+
+// Stats summarizes an NTSM file from its header, without parsing the GLB
+type Stats struct {
+	FileSize     int64  // Encoded size in bytes, 0 if unknown
+	GLBSize      uint32 // Stored GLB size, after compression
+	Compressed   bool
+	EmitterCount int
+	TextureCount int
+	HasChecksum  bool
+}
+
+// Stats summarizes the header of a fileSize-byte file
+func (h *Header) Stats(fileSize int64) Stats {
+	s := Stats{
+		FileSize:     fileSize,
+		GLBSize:      h.GLBSize,
+		Compressed:   h.IsCompressed(),
+		TextureCount: int(h.TextureCount),
+		HasChecksum:  h.Checksum != 0,
+	}
+	if h.HasParticles() {
+		s.EmitterCount = int(h.ParticleSize) / emitterSize(h.Version)
+	}
+	return s
+}
+
+// Stats summarizes the container as of its last ReadFrom or WriteTo, which
+// set the header's sizes. FileSize is 0 before either
+func (c *Container) Stats() Stats {
+	return c.Header.Stats(c.size)
+}
+
+// String formats the stats on one line, e.g.
+// "2048 bytes, GLB 1800 bytes (compressed), 2 emitters, 0 textures, crc32"
+func (s Stats) String() string {
+	compressed := ""
+	if s.Compressed {
+		compressed = " (compressed)"
+	}
+	checksum := "no checksum"
+	if s.HasChecksum {
+		checksum = "crc32"
+	}
+	return fmt.Sprintf("%d bytes, GLB %d bytes%s, %d emitters, %d textures, %s",
+		s.FileSize, s.GLBSize, compressed, s.EmitterCount, s.TextureCount, checksum)
+}
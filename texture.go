@@ -0,0 +1,82 @@
+package ntsm
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"slices"
+)
+
+// TextureOptions controls transcoding of embedded textures at encode time
+type TextureOptions struct {
+	// Format is the MIME type to transcode to, e.g. "image/jpeg". Empty
+	// leaves textures as they are
+	Format string
+
+	// Quality is the lossy encoding quality, from 1 to 100; 0 uses the
+	// encoder's default
+	Quality int
+
+	// Force also transcodes textures already in Format or in a compressed
+	// format (JPEG, WebP or KTX2), which are otherwise kept as they are
+	Force bool
+
+	// Encoder encodes img in Format. It is needed for formats the standard
+	// library can't write, such as "image/webp" or "image/ktx2"; when nil
+	// only "image/png" and "image/jpeg" are supported
+	Encoder func(w io.Writer, img image.Image, quality int) error
+}
+
+// compressedTextureTypes are formats not worth transcoding again: lossy or
+// GPU-ready, so a second pass only loses quality
+var compressedTextureTypes = []string{"image/jpeg", "image/webp", "image/ktx2"}
+
+// TranscodeTextures returns textures converted as opts describes, each with
+// its MIME type updated and its name kept so lookups by name still work.
+// Translucent textures are kept as they are when transcoding to JPEG, which
+// has no alpha channel. The input slice is not modified
+func TranscodeTextures(textures []Texture, opts TextureOptions) ([]Texture, error) {
+	if opts.Quality < 0 || opts.Quality > 100 {
+		return nil, fmt.Errorf("ntsm: texture quality %d outside [0, 100]", opts.Quality)
+	}
+	if opts.Encoder == nil && opts.Format != "" && opts.Format != "image/png" && opts.Format != "image/jpeg" {
+		return nil, fmt.Errorf("ntsm: no encoder for texture format %q", opts.Format)
+	}
+
+	out := slices.Clone(textures)
+	for i, t := range textures {
+		if opts.Format == "" || !opts.Force && (t.MimeType == opts.Format || slices.Contains(compressedTextureTypes, t.MimeType)) {
+			continue
+		}
+		img, _, err := image.Decode(bytes.NewReader(t.Data))
+		if err != nil {
+			return nil, fmt.Errorf("ntsm: texture %q: %w", t.Name, err)
+		}
+		if o, ok := img.(interface{ Opaque() bool }); ok && opts.Format == "image/jpeg" && !o.Opaque() {
+			continue
+		}
+
+		var buf bytes.Buffer
+		switch {
+		case opts.Encoder != nil:
+			err = opts.Encoder(&buf, img, opts.Quality)
+		case opts.Format == "image/png":
+			err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+		default:
+			quality := opts.Quality
+			if quality == 0 {
+				quality = jpeg.DefaultQuality
+			}
+			err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ntsm: texture %q: %w", t.Name, err)
+		}
+		out[i].MimeType = opts.Format
+		out[i].Data = buf.Bytes()
+	}
+	return out, nil
+}
@@ -0,0 +1,100 @@
+package ntsm
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+)
+
+// testPNG returns a 32x32 PNG gradient with the given alpha
+func testPNG(t *testing.T, alpha uint8) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for y := range 32 {
+		for x := range 32 {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 8), uint8(y * 8), 128, alpha})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTranscodeTextures(t *testing.T) {
+	textures := []Texture{
+		{Name: "spark.png", MimeType: "image/png", Data: testPNG(t, 0xff)},
+		{Name: "smoke.png", MimeType: "image/png", Data: testPNG(t, 0x80)},
+	}
+	var jpg bytes.Buffer
+	jpeg.Encode(&jpg, image.NewGray(image.Rect(0, 0, 8, 8)), nil)
+	textures = append(textures, Texture{Name: "fire.jpg", MimeType: "image/jpeg", Data: jpg.Bytes()})
+
+	got, err := TranscodeTextures(textures, TextureOptions{Format: "image/jpeg", Quality: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].MimeType != "image/jpeg" || got[0].Name != "spark.png" {
+		t.Errorf("opaque PNG transcoded to %s %q, want image/jpeg spark.png", got[0].MimeType, got[0].Name)
+	}
+	if _, format, err := image.Decode(bytes.NewReader(got[0].Data)); err != nil || format != "jpeg" {
+		t.Errorf("transcoded data decodes as %q, %v", format, err)
+	}
+	if got[1].MimeType != "image/png" {
+		t.Errorf("translucent PNG transcoded to %s", got[1].MimeType)
+	}
+	if !bytes.Equal(got[2].Data, jpg.Bytes()) {
+		t.Error("JPEG input transcoded without Force")
+	}
+	if textures[0].MimeType != "image/png" {
+		t.Error("input slice modified")
+	}
+
+	// An already-PNG texture is only re-encoded with Force
+	got, err = TranscodeTextures(textures[:1], TextureOptions{Format: "image/png"})
+	if err != nil || !bytes.Equal(got[0].Data, textures[0].Data) {
+		t.Errorf("PNG to PNG without Force changed the data: %v", err)
+	}
+	got, err = TranscodeTextures(textures[:1], TextureOptions{Format: "image/png", Force: true})
+	if err != nil || bytes.Equal(got[0].Data, textures[0].Data) {
+		t.Errorf("PNG to PNG with Force left the data alone: %v", err)
+	}
+
+	if _, err := TranscodeTextures(textures, TextureOptions{Format: "image/webp"}); err == nil {
+		t.Error("transcoded to WebP without an encoder")
+	}
+	called := 0
+	webp := func(w io.Writer, img image.Image, quality int) error {
+		called++
+		_, err := w.Write([]byte("RIFF webp"))
+		return err
+	}
+	got, err = TranscodeTextures(textures, TextureOptions{Format: "image/webp", Encoder: webp})
+	if err != nil || called != 2 || got[0].MimeType != "image/webp" || got[2].MimeType != "image/jpeg" {
+		t.Errorf("custom encoder: called %d times, got %+v, %v", called, got, err)
+	}
+}
+
+func TestEncodeTranscodesTextures(t *testing.T) {
+	c := testContainer()
+	c.Emitters = nil
+	textures := []Texture{{Name: "spark.png", MimeType: "image/png", Data: testPNG(t, 0xff)}}
+
+	var buf bytes.Buffer
+	opts := EncodeOptions{Textures: TextureOptions{Format: "image/jpeg"}}
+	if err := EncodeWithOptions(&buf, &c.Header, c.GLB, nil, textures, opts); err != nil {
+		t.Fatal(err)
+	}
+	_, _, _, got, err := DecodeWithTextures(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].MimeType != "image/jpeg" {
+		t.Errorf("decoded textures %+v, want one image/jpeg", got)
+	}
+}
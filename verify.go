@@ -0,0 +1,142 @@
+package ntsm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Verify checks that the size-byte file in r is well formed: the header
+// is valid, every GLB is structurally sound, every emitter passes
+// ParticleEmitter.Validate, texture data lies within the file, metadata
+// parses, any thumbnail is a PNG, the checksum matches when present, and nothing
+// follows the last section (reported as ErrTrailingData). Unlike
+// Decode it reports every problem found, joined into one error. A header
+// that fails to validate ends the check early since nothing after it can
+// be trusted
+func Verify(r io.ReaderAt, size int64) error {
+	hdr, err := DecodeHeader(io.NewSectionReader(r, 0, HeaderSize))
+	if err != nil {
+		return err
+	}
+	if err := hdr.Validate(size); err != nil {
+		return err
+	}
+
+	// dataEnd grows past the header's regions as the tables are read
+	var errs []error
+	dataEnd := hdr.knownEnd()
+	if hdr.IsMultiMesh() {
+		if entries, err := readMeshTable(&seqReader{r: io.NewSectionReader(r, 0, size)}, hdr); err == nil {
+			for _, e := range entries {
+				dataEnd = max(dataEnd, int64(e.Offset)+int64(e.Size))
+			}
+		}
+	}
+	for i, glb := range verifyGLBs(r, size, hdr, &errs) {
+		err := validateGLB(glb)
+		switch {
+		case err == nil:
+		case hdr.IsMultiMesh():
+			errs = append(errs, fmt.Errorf("ntsm: mesh %d: %w", i, err))
+		default:
+			errs = append(errs, err)
+		}
+	}
+
+	if hdr.HasParticles() {
+		data, err := readSectionAt(r, hdr.ParticleOffset, hdr.ParticleSize)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ntsm: reading particles: %w", err))
+		} else {
+			emitters, err := decodeEmitters(data, hdr.ByteOrder, hdr.Version)
+			if err == nil {
+				err = validateEmitters(emitters, int(hdr.TextureCount))
+			}
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if hdr.TextureCount > 0 {
+		table, err := readSectionAt(r, hdr.TextureOffset, hdr.TextureCount*uint32(textureEntrySize))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ntsm: reading texture table: %w", err))
+		} else {
+			entries := make([]TextureEntry, hdr.TextureCount)
+			binary.Read(bytes.NewReader(table), hdr.ByteOrder.binary(), entries)
+			for i, e := range entries {
+				end := int64(e.Offset) + int64(e.Size)
+				if int64(e.Offset) < HeaderSize || end > size {
+					errs = append(errs, fmt.Errorf("ntsm: texture %d: region [%d, %d) outside the file", i, e.Offset, end))
+				}
+				dataEnd = max(dataEnd, end)
+			}
+		}
+	}
+
+	if hdr.HasMeta() {
+		data, err := readSectionAt(r, hdr.MetaOffset, hdr.MetaSize)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ntsm: reading metadata: %w", err))
+		} else if _, err := decodeMeta(data, hdr.ByteOrder); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if hdr.HasThumbnail() {
+		thumb, err := readSectionAt(r, hdr.ThumbnailOffset, hdr.ThumbnailSize)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ntsm: reading thumbnail: %w", err))
+		} else if !bytes.HasPrefix(thumb, []byte("\x89PNG")) {
+			errs = append(errs, errors.New("ntsm: thumbnail is not a PNG"))
+		}
+	}
+
+	if hdr.Checksum != 0 {
+		crc := crc32.NewIEEE()
+		if _, err := io.Copy(crc, io.NewSectionReader(r, HeaderSize, size-HeaderSize)); err != nil {
+			errs = append(errs, fmt.Errorf("ntsm: reading payload: %w", err))
+		} else if crc.Sum32() != hdr.Checksum {
+			errs = append(errs, fmt.Errorf("%w: computed %08x, header has %08x", ErrChecksumMismatch, crc.Sum32(), hdr.Checksum))
+		}
+	}
+
+	if dataEnd < size {
+		errs = append(errs, fmt.Errorf("%w: %d bytes after the last section at %d", ErrTrailingData, size-dataEnd, dataEnd))
+	}
+
+	return errors.Join(errs...)
+}
+
+// verifyGLBs returns every GLB in the file, decompressed, appending read
+// failures to errs
+func verifyGLBs(r io.ReaderAt, size int64, hdr *Header, errs *[]error) [][]byte {
+	if hdr.IsMultiMesh() {
+		sr := &seqReader{r: io.NewSectionReader(r, 0, size)}
+		meshes, err := readMeshes(sr, hdr, true, 0)
+		if err != nil {
+			*errs = append(*errs, err)
+			return nil
+		}
+		glbs := make([][]byte, len(meshes))
+		for i, m := range meshes {
+			glbs[i] = m.Data
+		}
+		return glbs
+	}
+
+	glb, err := readSectionAt(r, hdr.GLBOffset, hdr.GLBSize)
+	if err == nil && hdr.IsCompressed() {
+		glb, err = decompressGLB(glb, hdr.GLBRawSize)
+	}
+	if err != nil {
+		*errs = append(*errs, fmt.Errorf("ntsm: reading GLB: %w", err))
+		return nil
+	}
+	return [][]byte{glb}
+}